@@ -40,6 +40,7 @@ type GlobalConfiguration struct {
 	IdleTimeout               flaeg.Duration          `description:"maximum amount of time an idle (keep-alive) connection will remain idle before closing itself."`
 	InsecureSkipVerify        bool                    `description:"Disable SSL certificate verification"`
 	Retry                     *Retry                  `description:"Enable retry sending request if network error"`
+	HealthCheck               *HealthCheckConfig      `description:"Health check parameters"`
 	Docker                    *provider.Docker        `description:"Enable Docker backend"`
 	File                      *provider.File          `description:"Enable File backend"`
 	Web                       *WebProvider            `description:"Enable Web backend"`
@@ -325,6 +326,19 @@ type Retry struct {
 	Attempts int `description:"Number of attempts"`
 }
 
+// HealthCheckConfig contains the health check parameters shared by all the backends
+type HealthCheckConfig struct {
+	MaxConcurrentProbes int            `description:"Maximum number of servers of a backend probed at the same time, unlimited if zero"`
+	MaxInFlightProbes   int            `description:"Maximum number of probes in flight across all the backends, unlimited if zero"`
+	Interval            flaeg.Duration `description:"Default interval between two checks of the backends not setting one"`
+	Timeout             flaeg.Duration `description:"Default probe timeout of the backends not setting one"`
+	UnhealthyThreshold  int            `description:"Default number of failed probes before a server is removed, for the backends not setting one"`
+	HealthyThreshold    int            `description:"Default number of successful probes before a server is re-added, for the backends not setting one"`
+	LogLevel            string         `description:"Log level of the health checks, the global log level if empty"`
+	StateFile           string         `description:"File persisting the servers removed by the health checks across restarts, not persisted if empty"`
+	AllowedCommands     types.Commands `description:"Paths of the commands the backends can run in the exec health check mode, none if empty"`
+}
+
 // NewTraefikDefaultPointersConfiguration creates a TraefikConfiguration with pointers default values
 func NewTraefikDefaultPointersConfiguration() *TraefikConfiguration {
 	//default Docker
@@ -445,6 +459,7 @@ func NewTraefikDefaultPointersConfiguration() *TraefikConfiguration {
 		Rancher:       &defaultRancher,
 		DynamoDB:      &defaultDynamoDB,
 		Retry:         &Retry{},
+		HealthCheck:   &HealthCheckConfig{},
 	}
 
 	//default Rancher
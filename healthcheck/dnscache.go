@@ -0,0 +1,127 @@
+package healthcheck
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/containous/traefik/safe"
+)
+
+// dnsCache caches the addresses of the hostnames the probes connect to. Expired addresses
+// keep being used while they are resolved again in the background.
+type dnsCache struct {
+	ttl     time.Duration
+	timeout time.Duration
+	// lookupHost resolves a hostname, it is replaced by the tests.
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	lock    sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+type dnsEntry struct {
+	addrs      []string
+	expires    time.Time
+	refreshing bool
+}
+
+func newDNSCache(ttl, timeout time.Duration, resolver *net.Resolver) *dnsCache {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &dnsCache{
+		ttl:        ttl,
+		timeout:    timeout,
+		lookupHost: resolver.LookupHost,
+		entries:    make(map[string]*dnsEntry),
+	}
+}
+
+// lookup returns the addresses of a host, resolving it only if it is not cached yet,
+// and whether they come from the cache.
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, bool, error) {
+	c.lock.Lock()
+	entry, ok := c.entries[host]
+	if ok {
+		addrs := entry.addrs
+		if !entry.refreshing && time.Now().After(entry.expires) {
+			entry.refreshing = true
+			logger := contextLogger(ctx)
+			safe.Go(func() {
+				c.refresh(host, logger)
+			})
+		}
+		c.lock.Unlock()
+		return addrs, true, nil
+	}
+	c.lock.Unlock()
+	addrs, err := c.resolve(ctx, host)
+	return addrs, false, err
+}
+
+// resolve resolves a host and caches its addresses.
+func (c *dnsCache) resolve(ctx context.Context, host string) ([]string, error) {
+	addrs, err := c.lookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	c.entries[host] = &dnsEntry{addrs: addrs, expires: time.Now().Add(c.ttl)}
+	c.lock.Unlock()
+	return addrs, nil
+}
+
+// refresh resolves a cached host again, keeping its expired addresses if the resolution fails.
+func (c *dnsCache) refresh(host string, logger *logrus.Entry) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	if _, err := c.resolve(ctx, host); err != nil {
+		logger.Debugf("Health check failed to resolve %s again, keeping its cached addresses: %s", host, err)
+		c.lock.Lock()
+		if entry, ok := c.entries[host]; ok {
+			entry.refreshing = false
+		}
+		c.lock.Unlock()
+	}
+}
+
+// dial connects to one of the cached addresses of host, resolving it again
+// if none of them accepts the connection in case they are stale.
+func (c *dnsCache) dial(ctx context.Context, dialer *net.Dialer, network, host, port string) (net.Conn, error) {
+	addrs, cached, err := c.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialAddresses(ctx, dialer, network, addrs, port)
+	if err == nil || !cached {
+		return conn, err
+	}
+	c.invalidate(host)
+	if addrs, err = c.resolve(ctx, host); err != nil {
+		return nil, err
+	}
+	return dialAddresses(ctx, dialer, network, addrs, port)
+}
+
+// dialAddresses connects to the first of the addresses accepting the connection.
+func dialAddresses(ctx context.Context, dialer *net.Dialer, network string, addrs []string, port string) (net.Conn, error) {
+	var err error = &net.DNSError{Err: "no such host"}
+	for _, addr := range addrs {
+		conn, dialErr := dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if dialErr == nil {
+			return conn, nil
+		}
+		err = dialErr
+	}
+	return nil, err
+}
+
+// invalidate removes a host from the cache, so that it is resolved again on the next lookup.
+func (c *dnsCache) invalidate(host string) {
+	c.lock.Lock()
+	delete(c.entries, host)
+	c.lock.Unlock()
+}
@@ -0,0 +1,79 @@
+package healthcheck
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeResolver struct {
+	lock    sync.Mutex
+	addrs   []string
+	lookups int
+}
+
+func (r *fakeResolver) lookupHost(ctx context.Context, host string) ([]string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.lookups++
+	return r.addrs, nil
+}
+
+func (r *fakeResolver) count() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.lookups
+}
+
+func TestCheckHealthDNSCache(t *testing.T) {
+	ts := newTestServer(http.StatusOK)
+	defer ts.Close()
+	_, port, err := net.SplitHostPort(mustParseURL(t, ts.URL).Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := &fakeResolver{addrs: []string{"127.0.0.1"}}
+	backend := NewBackendHealthCheck(Options{URL: "/health", DNSCacheTTL: 50 * time.Millisecond})
+	defer backend.closeIdleConnections()
+	backend.dnsCache.lookupHost = resolver.lookupHost
+	// no keep-alive, so that each probe dials the server
+	backend.client.Transport.(*http.Transport).DisableKeepAlives = true
+
+	serverURL := mustParseURL(t, "http://backend.example:"+port)
+	for i := 0; i < 3; i++ {
+		if !checkHealth(context.Background(), serverURL, backend) {
+			t.Fatalf("probe %d: expected the server to be healthy", i)
+		}
+	}
+	if lookups := resolver.count(); lookups != 1 {
+		t.Errorf("got %d lookups, expected the addresses to be cached", lookups)
+	}
+
+	// expired addresses are still used while they are resolved again in the background
+	time.Sleep(60 * time.Millisecond)
+	if !checkHealth(context.Background(), serverURL, backend) {
+		t.Fatal("expected the server to be healthy with the expired addresses")
+	}
+	deadline := time.Now().Add(time.Second)
+	for resolver.count() != 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if lookups := resolver.count(); lookups != 2 {
+		t.Errorf("got %d lookups, expected the expired addresses to be refreshed", lookups)
+	}
+
+	// stale addresses refusing the connection are resolved again right away
+	backend.dnsCache.lock.Lock()
+	backend.dnsCache.entries["backend.example"] = &dnsEntry{addrs: []string{"127.0.0.2"}, expires: time.Now().Add(time.Hour)}
+	backend.dnsCache.lock.Unlock()
+	if !checkHealth(context.Background(), serverURL, backend) {
+		t.Fatal("expected the probe to fall back to a fresh resolution")
+	}
+	if lookups := resolver.count(); lookups != 3 {
+		t.Errorf("got %d lookups, expected the stale addresses to be resolved again", lookups)
+	}
+}
@@ -0,0 +1,103 @@
+package healthcheck
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/containous/traefik/safe"
+)
+
+// eventQueueSize is the number of events buffered for a subscriber before new events are dropped.
+const eventQueueSize = 100
+
+// Event describes a change of the health state of a server.
+type Event struct {
+	BackendID string
+	URL       *url.URL
+	// Labels is the metadata of the server set by Options.ServerLabels, if any.
+	Labels map[string]string
+	// Healthy is true when the server is put back in rotation and false when it is removed.
+	Healthy bool
+	// Draining is true when the server is removed because it reported a drain status.
+	Draining bool
+	Time     time.Time
+}
+
+type subscriber struct {
+	events chan Event
+}
+
+type subscribers struct {
+	lock sync.RWMutex
+	list []*subscriber
+}
+
+// Subscribe registers a function called for each health state change.
+// Events are delivered asynchronously: a slow subscriber never blocks the checks,
+// events are dropped instead once its queue is full.
+// The returned function cancels the subscription.
+func (hc *HealthCheck) Subscribe(fn func(Event)) func() {
+	sub := &subscriber{events: make(chan Event, eventQueueSize)}
+	hc.subscribers.lock.Lock()
+	hc.subscribers.list = append(hc.subscribers.list, sub)
+	hc.subscribers.lock.Unlock()
+
+	safe.Go(func() {
+		for event := range sub.events {
+			fn(event)
+		}
+	})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			hc.subscribers.lock.Lock()
+			defer hc.subscribers.lock.Unlock()
+			for i, s := range hc.subscribers.list {
+				if s == sub {
+					hc.subscribers.list = append(hc.subscribers.list[:i], hc.subscribers.list[i+1:]...)
+					break
+				}
+			}
+			close(sub.events)
+		})
+	}
+}
+
+type emptyHooks struct {
+	lock sync.RWMutex
+	list []func(backendID string)
+}
+
+// OnEmpty registers a function called when the health checks are about to remove the last
+// server in rotation of a backend, for example to page someone or to query the provider again.
+// It is called in its own goroutine and never delays the removal.
+func (hc *HealthCheck) OnEmpty(fn func(backendID string)) {
+	hc.emptyHooks.lock.Lock()
+	defer hc.emptyHooks.lock.Unlock()
+	hc.emptyHooks.list = append(hc.emptyHooks.list, fn)
+}
+
+func (hc *HealthCheck) notifyEmpty(backendID string) {
+	hc.emptyHooks.lock.RLock()
+	defer hc.emptyHooks.lock.RUnlock()
+	for _, fn := range hc.emptyHooks.list {
+		fn := fn
+		safe.Go(func() {
+			fn(backendID)
+		})
+	}
+}
+
+func (hc *HealthCheck) publish(event Event) {
+	hc.subscribers.lock.RLock()
+	defer hc.subscribers.lock.RUnlock()
+	for _, sub := range hc.subscribers.list {
+		select {
+		case sub.events <- event:
+		default:
+			hc.logger().Warnf("Dropping health check event for server %s of backend %s: subscriber is too slow", event.URL, event.BackendID)
+		}
+	}
+}
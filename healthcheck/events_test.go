@@ -0,0 +1,120 @@
+package healthcheck
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubscribeStateChanges(t *testing.T) {
+	var status int32 = http.StatusInternalServerError
+	ts := newTestServerFunc(func() int { return int(atomic.LoadInt32(&status)) })
+	defer ts.Close()
+
+	hc := New()
+	events := make(chan Event, 10)
+	unsubscribe := hc.Subscribe(func(event Event) {
+		events <- event
+	})
+	defer unsubscribe()
+
+	serverURL := mustParseURL(t, ts.URL)
+	lb := NewFakeLoadBalancer(serverURL)
+	backend := NewBackendHealthCheck(Options{URL: "/health", LB: lb, ServerLabels: map[string]map[string]string{
+		serverURL.String(): {"zone": "eu-west-1a"},
+	}})
+	defer backend.closeIdleConnections()
+
+	hc.checkBackend(context.Background(), "backend1", backend)
+	if event := expectEvent(t, events, "backend1", serverURL, false); event.Labels["zone"] != "eu-west-1a" {
+		t.Errorf("expected the event to carry the zone of the server, got %v", event.Labels)
+	}
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	hc.checkBackend(context.Background(), "backend1", backend)
+	expectEvent(t, events, "backend1", serverURL, true)
+
+	// no transition, no event
+	hc.checkBackend(context.Background(), "backend1", backend)
+	select {
+	case event := <-events:
+		t.Errorf("unexpected event %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSlowSubscriberDoesNotBlock(t *testing.T) {
+	hc := New()
+	block := make(chan struct{})
+	unsubscribe := hc.Subscribe(func(event Event) {
+		<-block
+	})
+	defer unsubscribe()
+	defer close(block)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 2*eventQueueSize; i++ {
+			hc.publish(Event{BackendID: "backend1"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publishing blocked on a slow subscriber")
+	}
+}
+
+func TestOnEmpty(t *testing.T) {
+	ts := newTestServer(http.StatusInternalServerError)
+	defer ts.Close()
+
+	hc := New()
+	emptied := make(chan string, 10)
+	hc.OnEmpty(func(backendID string) {
+		emptied <- backendID
+	})
+
+	serverURL := mustParseURL(t, ts.URL)
+	lb := NewFakeLoadBalancer(serverURL, mustParseURL(t, "http://127.0.0.1:1"))
+	backend := NewBackendHealthCheck(Options{URL: "/health", Timeout: 100 * time.Millisecond, LB: lb})
+	defer backend.closeIdleConnections()
+
+	hc.checkBackend(context.Background(), "backend1", backend)
+	if len(lb.Servers()) != 0 {
+		t.Fatalf("expected the backend to be emptied, got %v", lb.Servers())
+	}
+	select {
+	case backendID := <-emptied:
+		if backendID != "backend1" {
+			t.Errorf("got backend %s, expected backend1", backendID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the OnEmpty hook was not called")
+	}
+	select {
+	case backendID := <-emptied:
+		t.Errorf("unexpected call for backend %s", backendID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func expectEvent(t *testing.T, events <-chan Event, backendID string, serverURL *url.URL, healthy bool) Event {
+	var event Event
+	select {
+	case event = <-events:
+		if event.BackendID != backendID || event.URL.String() != serverURL.String() || event.Healthy != healthy {
+			t.Errorf("unexpected event %+v", event)
+		}
+		if event.Time.IsZero() {
+			t.Error("event time should be set")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no event received for %s (healthy=%t)", serverURL, healthy)
+	}
+	return event
+}
@@ -0,0 +1,24 @@
+package healthcheck
+
+import (
+	"context"
+	"net/url"
+	"os/exec"
+)
+
+// checkExec considers a server healthy if the configured command, run with the server URL as
+// its last argument, exits with status 0 within the timeout.
+func checkExec(ctx context.Context, serverURL *url.URL, backend *BackendHealthCheck) bool {
+	if len(backend.Command) == 0 {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, backend.requestTimeout)
+	defer cancel()
+
+	args := append(append([]string(nil), backend.Command[1:]...), serverURL.String())
+	if err := exec.CommandContext(ctx, backend.Command[0], args...).Run(); err != nil {
+		contextLogger(ctx).Debugf("HealthCheck command of [%s] failed: %s", serverURL.String(), err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package healthcheck
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheckHealthExec(t *testing.T) {
+	serverURL := mustParseURL(t, "http://10.0.0.1:8080")
+
+	cases := []struct {
+		desc     string
+		command  []string
+		expected bool
+	}{
+		{desc: "success", command: []string{"sh", "-c", `test "$1" = http://10.0.0.1:8080`, "sh"}, expected: true},
+		{desc: "failure", command: []string{"sh", "-c", "exit 1"}, expected: false},
+		{desc: "unknown command", command: []string{"/nonexistent/command"}, expected: false},
+		{desc: "no command", expected: false},
+		{desc: "timeout", command: []string{"sh", "-c", "sleep 5"}, expected: false},
+	}
+	for _, c := range cases {
+		backend := NewBackendHealthCheck(Options{Mode: ModeExec, Command: c.command, Timeout: 200 * time.Millisecond})
+		start := time.Now()
+		if healthy := checkHealth(context.Background(), serverURL, backend); healthy != c.expected {
+			t.Errorf("%s: got healthy=%t, expected %t", c.desc, healthy, c.expected)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s: expected the command to be canceled after the timeout, took %s", c.desc, elapsed)
+		}
+	}
+}
+
+func TestSetBackendsConfigurationRejectsCommands(t *testing.T) {
+	hc := New()
+	hc.SetAllowedCommands([]string{"/usr/local/bin/check-status"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, "http://10.0.0.1:8080"))
+	hc.SetBackendsConfiguration(ctx, map[string]*BackendHealthCheck{
+		"allowed":   NewBackendHealthCheck(Options{Mode: ModeExec, Command: []string{"/usr/local/bin/../bin/check-status"}, Interval: time.Hour, LB: lb}),
+		"rejected":  NewBackendHealthCheck(Options{Mode: ModeExec, Command: []string{"sh", "-c", "touch /tmp/pwned"}, Interval: time.Hour, LB: lb}),
+		"nocommand": NewBackendHealthCheck(Options{Mode: ModeExec, Interval: time.Hour, LB: lb}),
+		"http":      NewBackendHealthCheck(Options{URL: "/health", Interval: time.Hour, LB: lb}),
+	})
+	for _, backendID := range []string{"rejected", "nocommand"} {
+		if hc.backend(backendID) != nil {
+			t.Errorf("expected the exec check of backend %s to be rejected", backendID)
+		}
+	}
+	for _, backendID := range []string{"allowed", "http"} {
+		if hc.backend(backendID) == nil {
+			t.Errorf("expected the check of backend %s to be started", backendID)
+		}
+	}
+
+	// without allowed commands, the exec mode is disabled
+	hc = New()
+	hc.SetBackendsConfiguration(ctx, map[string]*BackendHealthCheck{
+		"backend1": NewBackendHealthCheck(Options{Mode: ModeExec, Command: []string{"/usr/local/bin/check-status"}, Interval: time.Hour, LB: lb}),
+	})
+	if hc.backend("backend1") != nil {
+		t.Error("expected the exec check to be rejected without allowed commands")
+	}
+}
@@ -0,0 +1,92 @@
+package healthcheck
+
+import (
+	"net/url"
+	"sync"
+)
+
+// FakeCall is a change made by the health checks to a FakeLoadBalancer.
+type FakeCall struct {
+	// Upsert is true for the UpsertServer calls and false for the RemoveServer calls.
+	Upsert bool
+	URL    *url.URL
+	Weight int
+}
+
+// FakeLoadBalancer is an in-memory LoadBalancer recording the changes made by the health
+// checks, to write deterministic tests. It is safe for concurrent use.
+type FakeLoadBalancer struct {
+	lock    sync.Mutex
+	servers []*url.URL
+	weights map[string]int
+	calls   []FakeCall
+}
+
+// NewFakeLoadBalancer returns a FakeLoadBalancer holding the given servers.
+func NewFakeLoadBalancer(servers ...*url.URL) *FakeLoadBalancer {
+	return &FakeLoadBalancer{servers: append([]*url.URL(nil), servers...), weights: make(map[string]int)}
+}
+
+// SetServers replaces the servers of the load balancer without recording a call, as a
+// configuration reload would.
+func (lb *FakeLoadBalancer) SetServers(servers ...*url.URL) {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	lb.servers = append([]*url.URL(nil), servers...)
+}
+
+// Calls returns the UpsertServer and RemoveServer calls made so far, in order.
+func (lb *FakeLoadBalancer) Calls() []FakeCall {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	return append([]FakeCall(nil), lb.calls...)
+}
+
+// RemoveServer implements LoadBalancer.
+func (lb *FakeLoadBalancer) RemoveServer(u *url.URL) error {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	lb.calls = append(lb.calls, FakeCall{URL: u})
+	for i, server := range lb.servers {
+		if server.String() == u.String() {
+			lb.servers = append(lb.servers[:i], lb.servers[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// UpsertServer implements LoadBalancer.
+func (lb *FakeLoadBalancer) UpsertServer(u *url.URL, weight int) error {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	lb.calls = append(lb.calls, FakeCall{Upsert: true, URL: u, Weight: weight})
+	lb.weights[u.String()] = weight
+	for _, server := range lb.servers {
+		if server.String() == u.String() {
+			return nil
+		}
+	}
+	lb.servers = append(lb.servers, u)
+	return nil
+}
+
+// Servers implements LoadBalancer.
+func (lb *FakeLoadBalancer) Servers() []*url.URL {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	return append([]*url.URL(nil), lb.servers...)
+}
+
+// ServerWeight returns the weight of a server in rotation, known once it has been upserted.
+func (lb *FakeLoadBalancer) ServerWeight(u *url.URL) (int, bool) {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	for _, server := range lb.servers {
+		if server.String() == u.String() {
+			weight, ok := lb.weights[u.String()]
+			return weight, ok
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,33 @@
+package healthcheck
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestFakeLoadBalancer(t *testing.T) {
+	ts := newTestServer(http.StatusServiceUnavailable)
+	defer ts.Close()
+	serverURL := mustParseURL(t, ts.URL)
+
+	lb := NewFakeLoadBalancer(serverURL)
+	backend := NewBackendHealthCheck(Options{URL: "/health", LB: lb})
+	defer backend.closeIdleConnections()
+	New().checkBackend(context.Background(), "backend", backend)
+
+	if servers := lb.Servers(); len(servers) != 0 {
+		t.Errorf("expected the failing server to be removed, got %v", servers)
+	}
+	expected := []FakeCall{{URL: serverURL}}
+	if calls := lb.Calls(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("got calls %v, expected %v", calls, expected)
+	}
+
+	lb.SetServers(serverURL)
+	if servers := lb.Servers(); !reflect.DeepEqual(servers, []*url.URL{serverURL}) || len(lb.Calls()) != 1 {
+		t.Errorf("expected the servers to be replaced without recording a call, got %v", servers)
+	}
+}
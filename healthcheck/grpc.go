@@ -0,0 +1,66 @@
+package healthcheck
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// grpcHealthCheckMethod is the method of the standard gRPC health checking protocol,
+// see https://github.com/grpc/grpc/blob/master/doc/health-checking.md
+const grpcHealthCheckMethod = "/grpc.health.v1.Health/Check"
+
+// grpcServingStatusServing is the SERVING value of the grpc.health.v1 ServingStatus enum.
+const grpcServingStatusServing = 1
+
+// grpcHealthCheckRequest is the grpc.health.v1 HealthCheckRequest message.
+type grpcHealthCheckRequest struct {
+	Service string `protobuf:"bytes,1,opt,name=service" json:"service,omitempty"`
+}
+
+func (m *grpcHealthCheckRequest) Reset()         { *m = grpcHealthCheckRequest{} }
+func (m *grpcHealthCheckRequest) String() string { return proto.CompactTextString(m) }
+func (*grpcHealthCheckRequest) ProtoMessage()    {}
+
+// grpcHealthCheckResponse is the grpc.health.v1 HealthCheckResponse message.
+type grpcHealthCheckResponse struct {
+	Status int32 `protobuf:"varint,1,opt,name=status" json:"status,omitempty"`
+}
+
+func (m *grpcHealthCheckResponse) Reset()         { *m = grpcHealthCheckResponse{} }
+func (m *grpcHealthCheckResponse) String() string { return proto.CompactTextString(m) }
+func (*grpcHealthCheckResponse) ProtoMessage()    {}
+
+// checkGRPC considers a server healthy if it reports the SERVING status through the
+// gRPC health checking protocol, for the configured service or the whole server.
+func checkGRPC(ctx context.Context, serverURL *url.URL, backend *BackendHealthCheck) bool {
+	ctx, cancel := context.WithTimeout(ctx, backend.requestTimeout)
+	defer cancel()
+
+	target := probeTarget(serverURL, backend)
+	options := []grpc.DialOption{
+		grpc.WithBlock(),
+		grpc.WithDialer(func(address string, _ time.Duration) (net.Conn, error) {
+			return backend.dialContext(ctx, "tcp", address)
+		}),
+	}
+	if target.Scheme == "https" {
+		options = append(options, grpc.WithTransportCredentials(credentials.NewTLS(backend.tlsConfig())))
+	} else {
+		options = append(options, grpc.WithInsecure())
+	}
+	conn, err := grpc.DialContext(ctx, hostPort(target), options...)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	response := &grpcHealthCheckResponse{}
+	err = grpc.Invoke(ctx, grpcHealthCheckMethod, &grpcHealthCheckRequest{Service: backend.GRPCService}, response, conn)
+	return err == nil && response.Status == grpcServingStatusServing
+}
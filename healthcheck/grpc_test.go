@@ -0,0 +1,69 @@
+package healthcheck
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	netcontext "golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+type testHealthServer struct {
+	statuses map[string]int32
+}
+
+func (s *testHealthServer) check(srv interface{}, ctx netcontext.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	request := &grpcHealthCheckRequest{}
+	if err := dec(request); err != nil {
+		return nil, err
+	}
+	return &grpcHealthCheckResponse{Status: s.statuses[request.Service]}, nil
+}
+
+func newTestGRPCServer(t *testing.T, statuses map[string]int32) (*grpc.Server, net.Listener) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	health := &testHealthServer{statuses: statuses}
+	server := grpc.NewServer()
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "grpc.health.v1.Health",
+		HandlerType: (*interface{})(nil),
+		Methods:     []grpc.MethodDesc{{MethodName: "Check", Handler: health.check}},
+	}, health)
+	go server.Serve(listener)
+	return server, listener
+}
+
+func TestCheckHealthGRPC(t *testing.T) {
+	server, listener := newTestGRPCServer(t, map[string]int32{
+		"":        grpcServingStatusServing,
+		"serving": grpcServingStatusServing,
+		"stopped": 2,
+	})
+	serverURL := mustParseURL(t, "http://"+listener.Addr().String())
+
+	cases := []struct {
+		service  string
+		expected bool
+	}{
+		{service: "", expected: true},
+		{service: "serving", expected: true},
+		{service: "stopped", expected: false},
+		{service: "unknown", expected: false},
+	}
+	for _, c := range cases {
+		backend := NewBackendHealthCheck(Options{Mode: ModeGRPC, GRPCService: c.service})
+		if healthy := checkHealth(context.Background(), serverURL, backend); healthy != c.expected {
+			t.Errorf("service %q: got healthy=%t, expected %t", c.service, healthy, c.expected)
+		}
+	}
+
+	server.Stop()
+	if checkHealth(context.Background(), serverURL, NewBackendHealthCheck(Options{Mode: ModeGRPC, Timeout: 100 * time.Millisecond})) {
+		t.Error("expected the gRPC probe to fail against a stopped server")
+	}
+}
@@ -1,117 +1,2287 @@
 package healthcheck
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
-	"github.com/containous/traefik/log"
+	"github.com/Sirupsen/logrus"
 	"github.com/containous/traefik/safe"
-	"github.com/vulcand/oxy/roundrobin"
+	"github.com/containous/traefik/types"
+	"github.com/containous/traefik/version"
+)
+
+// defaultRequestTimeout is the probe timeout used when Options.Timeout is not set.
+const defaultRequestTimeout = 5 * time.Second
+
+// maxRetryAfter bounds the delay requested by the Retry-After header of a failed probe.
+const maxRetryAfter = time.Hour
+
+// failureRateWindow is the number of recent probes of a server its failure rate is computed over.
+const failureRateWindow = 10
+
+// latencySmoothing is the weight of the last probe latency in the smoothed latency of a server.
+const latencySmoothing = 0.3
+
+// retryBackoff is the base delay before retrying a failed probe, doubled for each retry.
+const retryBackoff = 100 * time.Millisecond
+
+// DefaultInterval is the interval between two checks used when none is configured.
+const DefaultInterval = 30 * time.Second
+
+const (
+	maxDrainSize = 4 << 10
+	// maxBodySize bounds the amount of the response body read to match the expected body.
+	maxBodySize = 64 << 10
+)
+
+const (
+	// ModeHTTP probes servers with an HTTP request.
+	ModeHTTP = "http"
+	// ModeTCP probes servers by opening a TCP connection.
+	ModeTCP = "tcp"
+	// ModeGRPC probes servers with the standard gRPC health checking protocol.
+	ModeGRPC = "grpc"
+	// ModeUDP probes servers by sending a datagram and waiting for a response.
+	ModeUDP = "udp"
+	// ModeExec probes servers by running a local command.
+	ModeExec = "exec"
+)
+
+// Rules combining the results of the probes of the health endpoints of a server.
+const (
+	// RequireAll considers a server healthy if all its health endpoints are healthy.
+	RequireAll = "all"
+	// RequireAny considers a server healthy if any of its health endpoints is healthy.
+	RequireAny = "any"
+)
+
+// States of a server reported in the fields of the transition logs.
+const (
+	stateUp       = "up"
+	stateDown     = "down"
+	stateDraining = "draining"
+)
+
+// probeResult is the outcome of a probe.
+type probeResult int
+
+const (
+	probeUnhealthy probeResult = iota
+	probeHealthy
+	// probeDraining is reported by the servers answering with a drain status: they are
+	// removed from rotation without being counted as failed.
+	probeDraining
 )
 
 var singleton *HealthCheck
 var once sync.Once
 
 // GetHealthCheck Get HealtchCheck Singleton
+//
+// Deprecated: the singleton is shared by all the servers of the process, each server should own
+// the HealthCheck returned by New instead.
 func GetHealthCheck() *HealthCheck {
 	once.Do(func() {
-		singleton = newHealthCheck()
+		singleton = New()
 	})
 	return singleton
 }
 
+// Options are the public health check options.
+type Options struct {
+	// Mode is the kind of probe sent to the servers, ModeHTTP when empty.
+	Mode string
+	// URL is the path of the health endpoint, relative to the server URL.
+	// The {host} and {port} placeholders are replaced by the host and port of each server.
+	URL string
+	// SchemeURLs override URL, by scheme of the probes, for the servers whose health endpoint
+	// path depends on the scheme they are probed with.
+	SchemeURLs map[string]string
+	// URLs are the paths of additional health endpoints probed after URL in ModeHTTP.
+	URLs []string
+	// Require is the rule combining the results of the probes of URL and URLs, RequireAll when empty.
+	Require string
+	// Scheme overrides the scheme of the server URL for the probes when set.
+	Scheme string
+	// Port overrides the port of the server URL for the probes when not zero.
+	Port int
+	// ServerPorts override Port, by server URL, for the servers exposing their health endpoint
+	// on a port of their own, such as the dynamic host ports of containers.
+	ServerPorts map[string]int
+	// Socket is the path of a Unix domain socket the probes connect to instead of the servers,
+	// such as the admin socket of a sidecar, in every mode but ModeUDP. The HTTP probes keep requesting the URL path.
+	Socket string
+	// Hosts maps the hostnames of the servers to the host, name or IP, the probes connect to instead.
+	// The probes keep the original hostname for the Host header and TLS verification.
+	Hosts map[string]string
+	// ServerLabels holds the metadata of the servers, such as their zone or instance ID, by server URL.
+	// They tag the logs and events of the health transitions and the server labels metric.
+	ServerLabels map[string]map[string]string
+	// Resolver resolves the hostnames of the servers for the probes, the default resolver when nil.
+	Resolver *net.Resolver `json:"-"`
+	// DNSCacheTTL caches the addresses of the hostnames of the servers for the probes, when positive.
+	// Expired addresses are resolved again in the background, and right away if none of them accepts the connection.
+	DNSCacheTTL time.Duration
+	// InsecureSkipVerify disables the verification of the certificates presented by HTTPS health endpoints.
+	InsecureSkipVerify bool
+	// Certificates are presented to the health endpoints requiring client authentication.
+	Certificates []tls.Certificate `json:"-"`
+	// RootCAs verifies the certificates of the health endpoints, the system pool when nil.
+	RootCAs *x509.CertPool `json:"-"`
+	// TLSServerName is sent as SNI and verified against the certificates of the health endpoints
+	// instead of the hostname of the servers, such as when servers are registered by IP.
+	TLSServerName string
+	// MinCertValidity fails the HTTPS probes of the servers whose certificate expires
+	// in less than MinCertValidity when positive.
+	MinCertValidity time.Duration
+	// GRPCService is the service checked in ModeGRPC, the whole server when empty.
+	GRPCService string
+	// Payload is the datagram sent to the servers in ModeUDP.
+	Payload string
+	// Command is the command, followed by its arguments, run in ModeExec with the server URL
+	// as its last argument. The server is healthy if it exits with status 0.
+	Command []string
+	// Method is the HTTP method of the probes, GET when empty.
+	Method string
+	// HTTP2 sends the HTTP probes over HTTP/2: negotiated with ALPN over TLS,
+	// and with prior knowledge (h2c) over cleartext connections.
+	HTTP2 bool
+	// FollowRedirects makes the HTTP probes follow redirects, otherwise the status
+	// of the first response is evaluated.
+	FollowRedirects bool
+	// UseProxy sends the HTTP probes through the proxy set by the HTTP_PROXY, HTTPS_PROXY and
+	// NO_PROXY environment variables, the probes connect directly to the servers otherwise.
+	UseProxy bool
+	// Body is sent with the HTTP probes when not empty, with the ContentType content type if set.
+	Body        string
+	ContentType string
+	// UserAgent is the User-Agent of the HTTP probes, Traefik-HealthCheck/<version> when empty.
+	UserAgent string
+	// Accept is the Accept header of the HTTP probes, such as application/json, for the health
+	// endpoints negotiating the content of their response. No Accept header is sent when empty.
+	Accept string
+	// Username and Password are the basic auth credentials of the HTTP probes, none are sent when Username is empty.
+	Username string
+	Password Secret
+	// Headers are added to the HTTP probes. The Host header overrides the request host,
+	// and an empty User-Agent header sends the probes without any.
+	Headers map[string]string
+	// Interval is the duration between two checks of the servers, DefaultInterval when not positive.
+	Interval time.Duration
+	// Retries is the number of times a failed probe is retried within a check, after a short
+	// jittered backoff, before the server is considered as failing.
+	Retries int
+	// Timeout bounds the duration of a probe, 5 seconds when zero.
+	// It should be shorter than the interval.
+	Timeout time.Duration
+	// ObserveOnly computes and logs the state of the servers without ever updating the load balancer.
+	ObserveOnly bool
+	// StartUnhealthy holds the servers out of rotation from the first time they are seen
+	// until they pass the healthy threshold.
+	StartUnhealthy bool
+	// SkipInitialCheck assumes the servers healthy until the first scheduled check, one interval
+	// after the checks start, instead of checking them right away.
+	SkipInitialCheck bool
+	// FastAdmission puts the new servers held out of rotation by StartUnhealthy in
+	// rotation after their first successful probe, HealthyThreshold still applying to the
+	// servers removed after failing.
+	FastAdmission bool
+	// FailOpen keeps the last server of the load balancer in rotation even when it fails,
+	// until one of its siblings recovers.
+	FailOpen bool
+	// MaxEjectionPercent is the percentage, from 1 to 100, of the servers of the backend which
+	// can be removed at the same time, unlimited when zero. Failing servers beyond it are kept in rotation.
+	MaxEjectionPercent int
+	// MaxBackoff enables the backoff of the removed servers when positive: the delay
+	// between two probes of a server that keeps failing doubles from the interval up to MaxBackoff,
+	// and is reset once the server recovers.
+	MaxBackoff time.Duration
+	// CircuitThreshold opens the circuit of a removed server after that many consecutive probes
+	// whose connection was refused, when positive: the server is not probed for CircuitCooldown,
+	// then a single trial probe either closes the circuit or opens it again.
+	CircuitThreshold int
+	CircuitCooldown  time.Duration
+	// Jitter is the percentage, from 0 to 100, by which the interval between two probes of a server
+	// randomly varies, spreading the probes of the servers of a backend over time.
+	Jitter int
+	// SlowStart is the duration over which the weight of a recovered server ramps up
+	// from 1 to its weight before removal, the server recovers at full weight when zero.
+	SlowStart time.Duration
+	// MaxConcurrentChecks bounds the number of servers of the backend probed at the same time,
+	// overriding the bound set with SetMaxConcurrentProbes. The bound set with it applies when zero.
+	MaxConcurrentChecks int
+	// InitialJitter delays the first check by a random duration of up to one interval,
+	// spreading the probes of the backends over time.
+	InitialJitter bool
+	// ExpectedStatus is the set of status codes considered healthy, 200 only when empty.
+	ExpectedStatus StatusCodes
+	// DrainStatus is the set of status codes reporting a server as draining: it is removed
+	// from rotation right away, but logged and measured apart from the failed servers.
+	DrainStatus StatusCodes
+	// LoadHeader is the name of a response header in which the servers report their load, from 0 to 1,
+	// such as X-Load. When set, the weight of a server in rotation is scaled down by its load,
+	// so that loaded servers receive less traffic. A missing or invalid load means full weight.
+	LoadHeader string
+	// ExpectedHeaders are the values the headers of the response must have to be healthy, by header name.
+	ExpectedHeaders map[string]string
+	// ExpectedBody is a substring the response body, or the response datagram in ModeUDP, must contain to be healthy.
+	ExpectedBody string
+	// ExpectedBodyRegexp is a regular expression the response body must match to be healthy.
+	ExpectedBodyRegexp *regexp.Regexp `json:"-"`
+	// CheckFunc determines the health of a server from the response to an HTTP probe when set,
+	// replacing the status and body checks. The response body is closed once it returns.
+	CheckFunc func(*http.Response) bool `json:"-"`
+	// ProbeFunc replaces the probe of the configured mode when set, for instance to send the
+	// probe through the same middlewares as the requests forwarded to the server.
+	ProbeFunc func(ctx context.Context, serverURL *url.URL) bool `json:"-"`
+	// DesiredWeight returns the weight the configuration currently intends for a server when set.
+	// It is consulted when a removed server is put back, rather than the weight it had when removed.
+	DesiredWeight func(serverURL *url.URL) (weight int, ok bool) `json:"-"`
+	// WarmupGrace is the duration after a server is first checked during which its failed
+	// probes are ignored, giving slow-booting servers the time to become ready.
+	WarmupGrace time.Duration
+	// DeepURL is the path of a slower health endpoint, such as one checking the dependencies
+	// of the server, probed in ModeHTTP after a successful probe at most once per DeepInterval.
+	// The server fails while its last deep probe failed.
+	DeepURL string
+	// DeepInterval is the minimum duration between two deep probes of a server, zero to probe
+	// DeepURL at every check.
+	DeepInterval time.Duration
+	// MaxLatency fails the probes of a server while its smoothed probe latency exceeds it,
+	// removing the servers getting slower before they fail, when not zero.
+	MaxLatency time.Duration
+	// UnhealthyThreshold is the number of consecutive failed probes before a server is removed.
+	UnhealthyThreshold int
+	// HealthyThreshold is the number of consecutive successful probes before a server is re-added.
+	HealthyThreshold int
+	// UnhealthyDuration is the duration a server must have been failing continuously before it is
+	// removed, and HealthyDuration the duration a removed server must have been passing continuously
+	// before it is re-added, whatever the number of probes in that time. They apply in addition
+	// to the thresholds and are disabled when zero.
+	UnhealthyDuration time.Duration
+	HealthyDuration   time.Duration
+	// LB is the load balancer holding the checked servers.
+	LB LoadBalancer `json:"-"`
+}
+
+// Redacted replaces the secrets of the configuration, such as the health check passwords, when they are logged or exposed.
+const Redacted = types.Redacted
+
+// Secret is a string that is formatted and encoded as Redacted, so that it never leaks into the logs.
+type Secret string
+
+// String implements fmt.Stringer.
+func (Secret) String() string {
+	return Redacted
+}
+
+// GoString implements fmt.GoStringer.
+func (Secret) GoString() string {
+	return Redacted
+}
+
+// MarshalJSON implements json.Marshaler.
+func (Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(Redacted)
+}
+
 // BackendHealthCheck HealthCheck configuration for a backend
 type BackendHealthCheck struct {
-	URL          string
-	Interval     time.Duration
-	DisabledURLs []*url.URL
-	lb           loadBalancer
+	Options
+	// lock guards disabledURLs and servers, which are read concurrently by the status accessors.
+	lock           sync.RWMutex
+	disabledURLs   urlSet
+	requestTimeout time.Duration
+	client         *http.Client
+	dnsCache       *dnsCache
+	servers        map[string]*serverState
+	// emptySince is the time the backend was first seen without any server, zero when it has servers.
+	emptySince time.Time
+	// sweep serializes the checks of the backend, run by its goroutine or by CheckNow.
+	sweep sync.Mutex
+}
+
+// urlSet is a set of server URLs keyed by their string form.
+type urlSet map[string]*url.URL
+
+// add adds a URL to the set, it is a no-op if the set already holds it.
+func (s urlSet) add(u *url.URL) {
+	s[u.String()] = u
+}
+
+func (s urlSet) contains(u *url.URL) bool {
+	_, ok := s[u.String()]
+	return ok
+}
+
+// sorted returns the URLs of the set in a stable order.
+func (s urlSet) sorted() []*url.URL {
+	urls := make([]*url.URL, 0, len(s))
+	for _, u := range s {
+		urls = append(urls, u)
+	}
+	sort.Slice(urls, func(i, j int) bool { return urls[i].String() < urls[j].String() })
+	return urls
+}
+
+// serverState tracks the consecutive probe outcomes of a server.
+type serverState struct {
+	successes int
+	failures  int
+	// passingSince is the time of the first probe of the current streak of successful probes,
+	// and failingSince the one of the current streak of failed probes.
+	passingSince time.Time
+	failingSince time.Time
+	// weight is the load-balancing weight the server had when it was removed.
+	weight int
+	// backoff is the current delay between two probes of a removed server, and nextCheck
+	// the earliest time of its next probe.
+	backoff   time.Duration
+	nextCheck time.Time
+	// firstSeen is the time the server was first checked.
+	firstSeen time.Time
+	// rampStart is the time a recovered server was re-added while its weight ramps up.
+	rampStart time.Time
+	// deepChecked is the time of the last deep probe of the server, and deepResult its outcome.
+	deepChecked time.Time
+	deepResult  probeOutcome
+	// held is true for a new server held out of rotation which has never been in rotation.
+	held bool
+	// lastChecked is the start time of the last probe of the server, and lastLatency its duration.
+	lastChecked time.Time
+	lastLatency time.Duration
+	// smoothedLatency is the exponentially weighted moving average of the probe latencies.
+	smoothedLatency time.Duration
+	// recentFailures is a ring buffer of the outcomes of the last probes, true for the failed
+	// ones, and probes the total number of probes.
+	recentFailures [failureRateWindow]bool
+	probes         int
+	// lastStatus is the status code of the response to the last HTTP probe, zero if there was none.
+	lastStatus int
+	// lastReason is the reason of the failure of the last probe, empty if it succeeded.
+	lastReason string
+	// refused is true when the connection of the last probe was refused, and refusals
+	// the number of consecutive failed probes whose connection was refused.
+	refused  bool
+	refusals int
+	// retryAfter is the time requested by the Retry-After header of the response to the last HTTP probe.
+	retryAfter time.Time
+	// load is the load reported in the LoadHeader of the response to the last HTTP probe, if loaded,
+	// and loadBase the weight it scales down.
+	load     float64
+	loaded   bool
+	loadBase int
+}
+
+// loadWeight returns weight scaled down by the last load reported by the server, at least 1.
+// It is weight itself when the server did not report a valid load.
+func (s *serverState) loadWeight(weight int) int {
+	if !s.loaded {
+		return weight
+	}
+	scaled := int(float64(weight)*(1-s.load) + 0.5)
+	if scaled < 1 {
+		return 1
+	}
+	return scaled
+}
+
+// recordOutcome adds the outcome of a probe to the ring buffer of the recent outcomes.
+func (s *serverState) recordOutcome(failed bool) {
+	s.recentFailures[s.probes%failureRateWindow] = failed
+	s.probes++
+}
+
+// failureRate returns the share of failed probes among the last failureRateWindow probes.
+func (s *serverState) failureRate() float64 {
+	window := s.probes
+	if window > failureRateWindow {
+		window = failureRateWindow
+	}
+	if window == 0 {
+		return 0
+	}
+	var failures int
+	for _, failed := range s.recentFailures[:window] {
+		if failed {
+			failures++
+		}
+	}
+	return float64(failures) / float64(window)
+}
+
+// openCircuit delays the next probe of a removed server by cooldown once threshold consecutive
+// probes were refused, and reports whether it did.
+func (s *serverState) openCircuit(now time.Time, threshold int, cooldown time.Duration) bool {
+	if threshold <= 0 || s.refusals < threshold {
+		return false
+	}
+	if until := now.Add(cooldown); until.After(s.nextCheck) {
+		s.nextCheck = until
+	}
+	return true
+}
+
+// delayUntilRetryAfter delays the next probe of a removed server to the time requested by its last response.
+func (s *serverState) delayUntilRetryAfter() {
+	if s.retryAfter.After(s.nextCheck) {
+		s.nextCheck = s.retryAfter
+	}
+}
+
+// record updates the consecutive counters with the outcome of a probe,
+// resetting the counter of the opposite outcome.
+func (s *serverState) record(healthy bool, now time.Time) {
+	if healthy {
+		if s.successes == 0 {
+			s.passingSince = now
+		}
+		s.successes++
+		s.failures = 0
+		s.refusals = 0
+		s.backoff = 0
+		s.nextCheck = time.Time{}
+	} else {
+		if s.failures == 0 {
+			s.failingSince = now
+		}
+		s.failures++
+		s.successes = 0
+		if s.refused {
+			s.refusals++
+		} else {
+			s.refusals = 0
+		}
+	}
+}
+
+// increaseBackoff doubles the delay before the next probe of a removed server,
+// starting from interval and capped to max.
+func (s *serverState) increaseBackoff(now time.Time, interval, max time.Duration) {
+	if s.backoff <= 0 {
+		s.backoff = interval
+	} else {
+		s.backoff *= 2
+	}
+	if s.backoff > max {
+		s.backoff = max
+	}
+	s.nextCheck = now.Add(s.backoff)
 }
 
-var launch = false
+// rampWeight returns the weight of a recovered server ramping up to its weight over window,
+// and whether the ramp is still in progress.
+func (s *serverState) rampWeight(now time.Time, window time.Duration) (int, bool) {
+	elapsed := now.Sub(s.rampStart)
+	if elapsed >= window {
+		return s.weight, false
+	}
+	weight := int(int64(s.weight) * int64(elapsed) / int64(window))
+	if weight < 1 {
+		weight = 1
+	}
+	return weight, true
+}
+
+// backingOff reports whether the next probe of a server is still delayed at the start of a check.
+// Half an interval of slack absorbs the scheduling delays of the checks.
+func (s *serverState) backingOff(now time.Time, interval time.Duration) bool {
+	return now.Add(interval / 2).Before(s.nextCheck)
+}
 
 //HealthCheck struct
 type HealthCheck struct {
 	Backends map[string]*BackendHealthCheck
+	lock     sync.RWMutex
+	ctx      context.Context
 	cancel   context.CancelFunc
+	// parent is the context the checks were started from, and running holds the cancel
+	// functions of the check goroutine of each backend, derived from ctx.
+	parent      context.Context
+	running     map[string]context.CancelFunc
+	metrics     *Metrics
+	subscribers subscribers
+	emptyHooks  emptyHooks
+	// wg tracks the running check goroutines.
+	wg sync.WaitGroup
+	// maxConcurrentProbes bounds the number of servers of a backend probed at the same time, unlimited when zero.
+	maxConcurrentProbes int
+	// inFlight is a semaphore bounding the number of probes in flight across all the backends, unlimited when nil.
+	inFlight chan struct{}
+	// paused holds the IDs of the backends whose checks are paused, it survives configuration reloads.
+	paused map[string]bool
+	// forcedDown holds, by backend ID, the servers put in maintenance, it survives configuration reloads.
+	forcedDown map[string]urlSet
+	// persistence saves the servers removed to the store set with SetStore, if any.
+	persistence persistence
+	// allowedCommands holds the cleaned paths of the commands the backends can run in ModeExec.
+	allowedCommands map[string]bool
+	// defaults holds the options inherited by the backends, see SetDefaultOptions.
+	defaults Options
+	// log is the logger of the health checks, see SetLogLevel.
+	log healthCheckLogger
 }
 
-type loadBalancer interface {
+// LoadBalancer includes functionality for load-balancing management.
+// It is independent of the load-balancing strategy: the health checks only take
+// servers out of rotation and put them back with a weight.
+type LoadBalancer interface {
+	// RemoveServer takes a server out of rotation.
 	RemoveServer(u *url.URL) error
-	UpsertServer(u *url.URL, options ...roundrobin.ServerOption) error
+	// UpsertServer puts a server in rotation with the given weight, or updates
+	// its weight if it is already in rotation. Strategies ignoring weights may ignore it.
+	UpsertServer(u *url.URL, weight int) error
+	// Servers returns the servers in rotation.
 	Servers() []*url.URL
 }
 
-func newHealthCheck() *HealthCheck {
-	return &HealthCheck{make(map[string]*BackendHealthCheck), nil}
+// weightedLoadBalancer is implemented by load balancers able to report the weight of a server,
+// which is then restored when the server recovers.
+type weightedLoadBalancer interface {
+	ServerWeight(u *url.URL) (int, bool)
+}
+
+// New returns a HealthCheck independent of the GetHealthCheck singleton.
+func New() *HealthCheck {
+	return &HealthCheck{Backends: make(map[string]*BackendHealthCheck)}
+}
+
+// SetMetrics sets the instruments updated by the health checks.
+func (hc *HealthCheck) SetMetrics(metrics *Metrics) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	hc.metrics = metrics
+}
+
+// getMetrics returns the instruments updated by the health checks, nil if none is set.
+func (hc *HealthCheck) getMetrics() *Metrics {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	return hc.metrics
+}
+
+// SetMaxConcurrentProbes bounds the number of servers of a backend probed at the same time, unlimited when zero.
+func (hc *HealthCheck) SetMaxConcurrentProbes(max int) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	hc.maxConcurrentProbes = max
+}
+
+// SetMaxInFlightProbes bounds the number of probes in flight at the same time across all the
+// backends, unlimited when zero. The probes over the limit wait for a slot rather than failing.
+func (hc *HealthCheck) SetMaxInFlightProbes(max int) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	if max <= 0 {
+		hc.inFlight = nil
+		return
+	}
+	hc.inFlight = make(chan struct{}, max)
+}
+
+// ParseInterval parses a health check interval such as "10s". It returns DefaultInterval for an
+// empty value, and an error for an invalid or non-positive value.
+func ParseInterval(value string) (time.Duration, error) {
+	if value == "" {
+		return DefaultInterval, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("interval %s must be positive", value)
+	}
+	return interval, nil
+}
+
+// SetDefaultOptions sets the options inherited by the backends created afterwards with the
+// NewBackendHealthCheck method: the Interval, Timeout, UnhealthyThreshold, HealthyThreshold and
+// Method left unset in their options take the value of the default options. The other fields,
+// whose zero value is meaningful, such as the booleans, are never inherited.
+func (hc *HealthCheck) SetDefaultOptions(options Options) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	hc.defaults = options
+}
+
+// withDefaults returns the options with their zero fields set from the default options.
+func (hc *HealthCheck) withDefaults(options Options) Options {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	if options.Interval == 0 {
+		options.Interval = hc.defaults.Interval
+	}
+	if options.Timeout == 0 {
+		options.Timeout = hc.defaults.Timeout
+	}
+	if options.UnhealthyThreshold == 0 {
+		options.UnhealthyThreshold = hc.defaults.UnhealthyThreshold
+	}
+	if options.HealthyThreshold == 0 {
+		options.HealthyThreshold = hc.defaults.HealthyThreshold
+	}
+	if options.Method == "" {
+		options.Method = hc.defaults.Method
+	}
+	return options
+}
+
+// Validate reports the first inconsistency of the options, so that a misconfigured health check
+// is rejected rather than mistaken for failing servers. It upper-cases the method, GET when empty.
+func (o *Options) Validate() error {
+	switch o.Mode {
+	case "", ModeHTTP, ModeTCP, ModeGRPC, ModeUDP, ModeExec:
+	default:
+		return fmt.Errorf("invalid healthcheck mode %q", o.Mode)
+	}
+	switch method := strings.ToUpper(o.Method); method {
+	case "":
+		o.Method = http.MethodGet
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		o.Method = method
+	default:
+		return fmt.Errorf("invalid healthcheck method %q", o.Method)
+	}
+	for _, path := range append([]string{o.URL}, o.URLs...) {
+		if err := validatePath(path); err != nil {
+			return err
+		}
+	}
+	if o.DeepURL != "" {
+		if o.Mode != "" && o.Mode != ModeHTTP {
+			return fmt.Errorf("invalid healthcheck deep URL, it requires the %s mode", ModeHTTP)
+		}
+		if err := validatePath(o.DeepURL); err != nil {
+			return err
+		}
+	}
+	if o.DeepInterval < 0 {
+		return fmt.Errorf("invalid healthcheck deep interval %s", o.DeepInterval)
+	}
+	for _, path := range o.SchemeURLs {
+		if err := validatePath(path); err != nil {
+			return err
+		}
+	}
+	if len(o.URLs) > 0 && o.Mode != "" && o.Mode != ModeHTTP {
+		return fmt.Errorf("invalid healthcheck urls, they require the %s mode", ModeHTTP)
+	}
+	if o.Require != "" && o.Require != RequireAll && o.Require != RequireAny {
+		return fmt.Errorf("invalid healthcheck require %q", o.Require)
+	}
+	if o.Scheme != "" && o.Scheme != "http" && o.Scheme != "https" {
+		return fmt.Errorf("invalid healthcheck scheme %q", o.Scheme)
+	}
+	if (o.Mode == ModeExec) != (len(o.Command) > 0) {
+		return fmt.Errorf("invalid healthcheck command, it must be set in and only in the %s mode", ModeExec)
+	}
+	if o.Socket != "" && o.Mode == ModeUDP {
+		return fmt.Errorf("invalid healthcheck socket %q, UDP health checks cannot use a socket", o.Socket)
+	}
+	if o.StartUnhealthy && o.SkipInitialCheck {
+		return errors.New("invalid healthcheck skipInitialCheck, it cannot be combined with startUnhealthy")
+	}
+	if o.Interval < 0 {
+		return fmt.Errorf("invalid healthcheck interval %s", o.Interval)
+	}
+	if o.Timeout < 0 {
+		return fmt.Errorf("invalid healthcheck timeout %s", o.Timeout)
+	}
+	if o.Port < 0 || o.Port > 65535 {
+		return fmt.Errorf("invalid healthcheck port %d", o.Port)
+	}
+	if o.Jitter < 0 || o.Jitter > 100 {
+		return fmt.Errorf("invalid healthcheck jitter %d, it must be a percentage", o.Jitter)
+	}
+	if o.Retries < 0 {
+		return fmt.Errorf("invalid healthcheck retries %d", o.Retries)
+	}
+	if o.CircuitThreshold < 0 || (o.CircuitThreshold > 0 && o.CircuitCooldown <= 0) {
+		return fmt.Errorf("invalid healthcheck circuit threshold %d with cooldown %s", o.CircuitThreshold, o.CircuitCooldown)
+	}
+	if o.DNSCacheTTL < 0 {
+		return fmt.Errorf("invalid healthcheck DNS cache TTL %s", o.DNSCacheTTL)
+	}
+	if o.MaxConcurrentChecks < 0 {
+		return fmt.Errorf("invalid healthcheck max concurrent checks %d", o.MaxConcurrentChecks)
+	}
+	if o.MaxEjectionPercent < 0 || o.MaxEjectionPercent > 100 {
+		return fmt.Errorf("invalid healthcheck max ejection percent %d, it must be a percentage", o.MaxEjectionPercent)
+	}
+	if o.UnhealthyThreshold < 0 || o.HealthyThreshold < 0 {
+		return fmt.Errorf("invalid healthcheck thresholds %d and %d", o.UnhealthyThreshold, o.HealthyThreshold)
+	}
+	if o.UnhealthyDuration < 0 || o.HealthyDuration < 0 {
+		return fmt.Errorf("invalid healthcheck durations %s and %s", o.UnhealthyDuration, o.HealthyDuration)
+	}
+	return nil
+}
+
+// validatePath checks that the path of a health endpoint is relative to the server URL.
+func validatePath(path string) error {
+	u, err := url.Parse(strings.NewReplacer("{host}", "host", "{port}", "80").Replace(path))
+	if err != nil {
+		return fmt.Errorf("invalid healthcheck URL %q: %v", path, err)
+	}
+	if u.Scheme != "" || u.Host != "" {
+		return fmt.Errorf("invalid healthcheck URL %q, it must be relative to the server URL", path)
+	}
+	return nil
 }
 
 // NewBackendHealthCheck Instantiate a new BackendHealthCheck
-func NewBackendHealthCheck(URL string, interval time.Duration, lb loadBalancer) *BackendHealthCheck {
-	return &BackendHealthCheck{URL, interval, nil, lb}
+// The options left unset take their default values. Invalid options, see Validate, are kept
+// as is: SetBackendsConfiguration rejects the backend.
+func NewBackendHealthCheck(options Options) *BackendHealthCheck {
+	return newBackendHealthCheck(options, standardLogger())
+}
+
+// NewBackendHealthCheck instantiates a new BackendHealthCheck inheriting the default options
+// of the health check, see SetDefaultOptions.
+func (hc *HealthCheck) NewBackendHealthCheck(options Options) *BackendHealthCheck {
+	return newBackendHealthCheck(hc.withDefaults(options), hc.logger())
+}
+
+func newBackendHealthCheck(options Options, logger *logrus.Entry) *BackendHealthCheck {
+	if options.Interval == 0 {
+		options.Interval = DefaultInterval
+	}
+	if options.UnhealthyThreshold == 0 {
+		options.UnhealthyThreshold = 1
+	}
+	if options.HealthyThreshold == 0 {
+		options.HealthyThreshold = 1
+	}
+	requestTimeout := options.Timeout
+	if requestTimeout <= 0 {
+		requestTimeout = defaultRequestTimeout
+	}
+	if options.Interval > 0 && requestTimeout >= options.Interval {
+		logger.Warnf("Health check timeout %s for %s is not shorter than the interval %s", requestTimeout, options.URL, options.Interval)
+	}
+	backend := &BackendHealthCheck{
+		Options:        options,
+		disabledURLs:   make(urlSet),
+		requestTimeout: requestTimeout,
+		servers:        make(map[string]*serverState),
+	}
+	if options.DNSCacheTTL > 0 {
+		backend.dnsCache = newDNSCache(options.DNSCacheTTL, requestTimeout, options.Resolver)
+	}
+	backend.client = &http.Client{
+		Timeout:   backend.requestTimeout,
+		Transport: newTransport(backend),
+	}
+	if !options.FollowRedirects {
+		backend.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return backend
+}
+
+// newTransport builds the keep-alive enabled transport shared by all the probes of a backend.
+func newTransport(backend *BackendHealthCheck) http.RoundTripper {
+	transport := &http.Transport{
+		DialContext:         backend.dialContext,
+		TLSClientConfig:     backend.tlsConfig(),
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	if backend.UseProxy {
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+	if backend.HTTP2 {
+		return newHTTP2Transport(backend, transport)
+	}
+	return transport
+}
+
+// NewResolver returns a resolver sending its DNS queries to the server at address, such as "10.0.0.2:53".
+func NewResolver(address string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, address)
+		},
+	}
+}
+
+// dialContext connects the probes to the servers, applying the host overrides, the resolver
+// and the DNS cache, or to the Unix domain socket if one is set.
+func (b *BackendHealthCheck) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if b.Socket != "" && !strings.HasPrefix(network, "udp") {
+		network, address = "unix", b.Socket
+	}
+	if host, port, err := net.SplitHostPort(address); err == nil {
+		if override, ok := b.Hosts[host]; ok {
+			address = net.JoinHostPort(override, port)
+		}
+	}
+	dialer := &net.Dialer{
+		Timeout:   b.requestTimeout,
+		KeepAlive: 30 * time.Second,
+		Resolver:  b.Resolver,
+	}
+	if b.dnsCache != nil && network != "unix" {
+		if host, port, err := net.SplitHostPort(address); err == nil && net.ParseIP(host) == nil {
+			return b.dnsCache.dial(ctx, dialer, network, host, port)
+		}
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// serverState returns the state of a server, creating it if needed.
+// It must be called with the lock held.
+func (b *BackendHealthCheck) serverState(u *url.URL) *serverState {
+	state, ok := b.servers[u.String()]
+	if !ok {
+		state = &serverState{firstSeen: time.Now()}
+		b.servers[u.String()] = state
+	}
+	return state
+}
+
+// removeServer takes a server out of rotation, or only logs it in observe-only mode.
+func (b *BackendHealthCheck) removeServer(logger *logrus.Entry, u *url.URL) {
+	if b.ObserveOnly {
+		logger.Infof("HealthCheck is observing only [%s]: server would be removed from server list", u.String())
+		return
+	}
+	b.LB.RemoveServer(u)
+}
+
+// upsertServer puts a server back in rotation, or only logs it in observe-only mode.
+func (b *BackendHealthCheck) upsertServer(logger *logrus.Entry, u *url.URL, weight int) {
+	if b.ObserveOnly {
+		logger.Infof("HealthCheck is observing only [%s]: server would be upserted in server list with weight %d", u.String(), weight)
+		return
+	}
+	b.LB.UpsertServer(u, weight)
+}
+
+// withoutDisabled filters out the servers considered disabled, which are checked apart. They are
+// still in the load balancer in observe-only mode, and may have been re-added by a racing
+// provider otherwise: they must neither be checked twice nor removed twice.
+func (b *BackendHealthCheck) withoutDisabled(urls []*url.URL) []*url.URL {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	var enabled []*url.URL
+	for _, u := range urls {
+		if !b.disabledURLs.contains(u) {
+			enabled = append(enabled, u)
+		}
+	}
+	return enabled
+}
+
+// tlsConfig returns the TLS configuration of the probes.
+func (b *BackendHealthCheck) tlsConfig() *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: b.InsecureSkipVerify,
+		Certificates:       b.Certificates,
+		RootCAs:            b.RootCAs,
+		ServerName:         b.TLSServerName,
+	}
+}
+
+// closeIdleConnections releases the connections kept alive by the backend probes.
+func (b *BackendHealthCheck) closeIdleConnections() {
+	if transport, ok := b.client.Transport.(interface{ CloseIdleConnections() }); ok {
+		transport.CloseIdleConnections()
+	}
 }
 
 //SetBackendsConfiguration set backends configuration
+// Only the checks of the backends whose configuration changed are restarted: the checks of
+// a backend with the same options and servers keep running and carry on with the new instance.
 func (hc *HealthCheck) SetBackendsConfiguration(parentCtx context.Context, backends map[string]*BackendHealthCheck) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	backends = hc.acceptedBackends(backends)
+	if hc.ctx == nil || hc.ctx.Err() != nil || hc.parent != parentCtx {
+		if hc.cancel != nil {
+			hc.cancel()
+		}
+		hc.ctx, hc.cancel = context.WithCancel(parentCtx)
+		hc.parent, hc.running = parentCtx, make(map[string]context.CancelFunc)
+	}
+	started := make(map[string]*BackendHealthCheck)
+	for backendID, backend := range backends {
+		previous, ok := hc.Backends[backendID]
+		unchanged := ok && previous == backend
+		if ok && previous != backend {
+			sameServers := backend.inherit(hc.backendLogger(backendID), previous)
+			unchanged = sameServers && sameChecks(previous.Options, backend.Options)
+		}
+		if _, running := hc.running[backendID]; running && unchanged {
+			hc.logger().Debugf("Keeping the health checks of backend %s running across the reload", backendID)
+			continue
+		}
+		if cancel, running := hc.running[backendID]; running {
+			cancel()
+		}
+		started[backendID] = backend
+	}
+	for backendID, cancel := range hc.running {
+		if _, ok := backends[backendID]; !ok {
+			cancel()
+			delete(hc.running, backendID)
+		}
+	}
+	for backendID, backend := range hc.Backends {
+		if backends[backendID] != backend {
+			backend.closeIdleConnections()
+		}
+	}
 	hc.Backends = backends
+	hc.execute(started)
+}
+
+// SetAllowedCommands sets the paths of the commands the backends can run in ModeExec. They come from
+// the static configuration: the commands of the backends are set by the providers, so the checks of
+// the backends running a command missing from the list are not started.
+func (hc *HealthCheck) SetAllowedCommands(paths []string) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	hc.allowedCommands = make(map[string]bool, len(paths))
+	for _, path := range paths {
+		hc.allowedCommands[filepath.Clean(path)] = true
+	}
+}
+
+// acceptedBackends returns the backends without the ones whose options are invalid, see Validate,
+// or running a command which is not allowed, the caller holds hc.lock.
+func (hc *HealthCheck) acceptedBackends(backends map[string]*BackendHealthCheck) map[string]*BackendHealthCheck {
+	allowed := make(map[string]*BackendHealthCheck, len(backends))
+	for backendID, backend := range backends {
+		if err := backend.Options.Validate(); err != nil {
+			hc.logger().Errorf("Health check of backend %s is disabled: %s", backendID, err)
+			backend.closeIdleConnections()
+			continue
+		}
+		if backend.Mode == ModeExec && (len(backend.Command) == 0 || !hc.allowedCommands[filepath.Clean(backend.Command[0])]) {
+			hc.logger().Errorf("Health check of backend %s is disabled: its command %v is not in the healthcheck allowedCommands", backendID, backend.Command)
+			backend.closeIdleConnections()
+			continue
+		}
+		allowed[backendID] = backend
+	}
+	return allowed
+}
+
+// sameChecks reports whether two options configure the same checks, whatever their load balancer.
+// The functions, resolvers and CA pools are not compared: the checks use the ones of the
+// current instance of the backend anyway.
+func sameChecks(a, b Options) bool {
+	if regexpString(a.ExpectedBodyRegexp) != regexpString(b.ExpectedBodyRegexp) {
+		return false
+	}
+	for _, o := range []*Options{&a, &b} {
+		o.LB, o.CheckFunc, o.ProbeFunc, o.DesiredWeight = nil, nil, nil, nil
+		o.Resolver, o.RootCAs, o.ExpectedBodyRegexp = nil, nil, nil
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func regexpString(re *regexp.Regexp) string {
+	if re == nil {
+		return ""
+	}
+	return re.String()
+}
+
+// backend returns the current instance of a backend, nil if it is not health checked anymore.
+func (hc *HealthCheck) backend(backendID string) *BackendHealthCheck {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	return hc.Backends[backendID]
+}
+
+// Pause suspends the checks of a backend until Resume is called: its servers are
+// neither probed nor added to or removed from the load balancer in the meantime.
+func (hc *HealthCheck) Pause(backendID string) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	if hc.paused == nil {
+		hc.paused = make(map[string]bool)
+	}
+	hc.paused[backendID] = true
+	hc.logger().Infof("Healthcheck of backend %s paused", backendID)
+}
+
+// Resume restarts the checks of a backend suspended by Pause, from its next scheduled check.
+func (hc *HealthCheck) Resume(backendID string) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	if hc.paused[backendID] {
+		delete(hc.paused, backendID)
+		hc.logger().Infof("Healthcheck of backend %s resumed", backendID)
+	}
+}
+
+// Paused reports whether the checks of a backend are paused.
+func (hc *HealthCheck) Paused(backendID string) bool {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	return hc.paused[backendID]
+}
+
+// StartMaintenance forces a server of a backend out of rotation regardless of its health,
+// from the next check of the backend until EndMaintenance is called.
+func (hc *HealthCheck) StartMaintenance(backendID string, u *url.URL) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	if hc.forcedDown == nil {
+		hc.forcedDown = make(map[string]urlSet)
+	}
+	if hc.forcedDown[backendID] == nil {
+		hc.forcedDown[backendID] = make(urlSet)
+	}
+	hc.forcedDown[backendID].add(u)
+	hc.logger().Infof("HealthCheck maintenance of [%s] in backend %s started", u.String(), backendID)
+}
+
+// EndMaintenance lets a server put in maintenance by StartMaintenance be re-added to the
+// load balancer once it passes the check.
+func (hc *HealthCheck) EndMaintenance(backendID string, u *url.URL) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	if hc.forcedDown[backendID].contains(u) {
+		delete(hc.forcedDown[backendID], u.String())
+		hc.logger().Infof("HealthCheck maintenance of [%s] in backend %s ended", u.String(), backendID)
+	}
+}
+
+// InMaintenance reports whether a server of a backend is in maintenance.
+func (hc *HealthCheck) InMaintenance(backendID string, u *url.URL) bool {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	return hc.forcedDown[backendID].contains(u)
+}
+
+// CheckNow checks the servers of a backend right away, without waiting for its next check.
+// It waits for the check of the backend in progress, if any, and returns an error if the
+// backend is unknown or paused.
+func (hc *HealthCheck) CheckNow(backendID string) error {
+	hc.lock.RLock()
+	backend, ok := hc.Backends[backendID]
+	ctx, paused := hc.ctx, hc.paused[backendID]
+	hc.lock.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown health checked backend %s", backendID)
+	}
+	if paused {
+		return fmt.Errorf("health check of backend %s is paused", backendID)
+	}
+	if ctx == nil || ctx.Err() != nil {
+		return fmt.Errorf("health checks are stopped")
+	}
+	hc.logger().Debugf("Forcing Healthcheck of backend %s", backendID)
+	hc.checkBackend(ctx, backendID, backend)
+	return nil
+}
+
+// Sweep checks the servers of all the backends once, synchronously, and returns when all the
+// checks are done. It bypasses the ticker of the backends, so that backends set in Backends
+// without SetBackendsConfiguration can be checked one deterministic pass at a time.
+// Paused backends are skipped.
+func (hc *HealthCheck) Sweep(ctx context.Context) {
+	hc.lock.RLock()
+	backends := make(map[string]*BackendHealthCheck, len(hc.Backends))
+	for backendID, backend := range hc.Backends {
+		backends[backendID] = backend
+	}
+	hc.lock.RUnlock()
+
+	var wg sync.WaitGroup
+	for backendID, backend := range backends {
+		wg.Add(1)
+		go func(backendID string, backend *BackendHealthCheck) {
+			defer wg.Done()
+			hc.checkBackendUnlessPaused(ctx, backendID, backend)
+		}(backendID, backend)
+	}
+	wg.Wait()
+}
+
+// Stop cancels the health checks and waits for the in-flight probes to finish,
+// or returns the error of ctx if it is done first.
+func (hc *HealthCheck) Stop(ctx context.Context) error {
+	hc.lock.Lock()
 	if hc.cancel != nil {
 		hc.cancel()
+		hc.cancel = nil
+	}
+	hc.running = nil
+	for _, backend := range hc.Backends {
+		backend.closeIdleConnections()
+	}
+	hc.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		hc.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	ctx, cancel := context.WithCancel(parentCtx)
-	hc.cancel = cancel
-	hc.execute(ctx)
 }
 
-func (hc *HealthCheck) execute(ctx context.Context) {
+// Status returns, for each backend, the URLs of the servers currently removed by the health check.
+func (hc *HealthCheck) Status() map[string][]string {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	status := make(map[string][]string, len(hc.Backends))
 	for backendID, backend := range hc.Backends {
+		status[backendID] = backend.disabledServers()
+	}
+	return status
+}
+
+// BackendOptions returns a snapshot of the options of each backend under health check, with
+// the defaults applied, by backend ID. The maps and slices of the options are copied, the other references are shared.
+func (hc *HealthCheck) BackendOptions() map[string]Options {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	options := make(map[string]Options, len(hc.Backends))
+	for backendID, backend := range hc.Backends {
+		options[backendID] = backend.Options.copy()
+	}
+	return options
+}
+
+// copy returns the options with copies of their maps and slices.
+func (o Options) copy() Options {
+	o.SchemeURLs = copyStrings(o.SchemeURLs)
+	o.URLs = append([]string(nil), o.URLs...)
+	o.Hosts = copyStrings(o.Hosts)
+	if o.ServerPorts != nil {
+		ports := make(map[string]int, len(o.ServerPorts))
+		for serverURL, port := range o.ServerPorts {
+			ports[serverURL] = port
+		}
+		o.ServerPorts = ports
+	}
+	if o.ServerLabels != nil {
+		labels := make(map[string]map[string]string, len(o.ServerLabels))
+		for serverURL, serverLabels := range o.ServerLabels {
+			labels[serverURL] = copyStrings(serverLabels)
+		}
+		o.ServerLabels = labels
+	}
+	o.Certificates = append([]tls.Certificate(nil), o.Certificates...)
+	o.Command = append([]string(nil), o.Command...)
+	o.Headers = copyStrings(o.Headers)
+	o.ExpectedHeaders = copyStrings(o.ExpectedHeaders)
+	o.ExpectedStatus = append(StatusCodes(nil), o.ExpectedStatus...)
+	o.DrainStatus = append(StatusCodes(nil), o.DrainStatus...)
+	return o
+}
+
+func copyStrings(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(m))
+	for key, value := range m {
+		copied[key] = value
+	}
+	return copied
+}
+
+// disabledServers returns a copy of the URLs of the servers currently removed by the health check.
+func (b *BackendHealthCheck) disabledServers() []string {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	servers := make([]string, 0, len(b.disabledURLs))
+	for _, u := range b.disabledURLs.sorted() {
+		servers = append(servers, u.String())
+	}
+	return servers
+}
+
+// ServerHealth reports whether a server of a backend is in rotation. checked is false
+// when the backend is not health checked, in which case healthy is meaningless.
+func (hc *HealthCheck) ServerHealth(backendID, serverURL string) (healthy bool, checked bool) {
+	hc.lock.RLock()
+	backend, ok := hc.Backends[backendID]
+	hc.lock.RUnlock()
+	if !ok {
+		return false, false
+	}
+	for _, server := range backend.disabledServers() {
+		if server == serverURL {
+			return false, true
+		}
+	}
+	return true, true
+}
+
+// HealthRatio returns the share of the servers of a backend which are in rotation, from 0 to 1.
+// ok is false when the backend is not health checked.
+func (hc *HealthCheck) HealthRatio(backendID string) (ratio float64, ok bool) {
+	hc.lock.RLock()
+	backend, found := hc.Backends[backendID]
+	hc.lock.RUnlock()
+	if !found {
+		return 0, false
+	}
+	return backend.HealthRatio(), true
+}
+
+// HealthRatio returns the share of the servers of the backend which are in rotation, from 0 to 1.
+// It is 0 when the backend has no server.
+func (b *BackendHealthCheck) HealthRatio() float64 {
+	enabled := len(b.withoutDisabled(b.LB.Servers()))
+	b.lock.RLock()
+	disabled := len(b.disabledURLs)
+	b.lock.RUnlock()
+	if enabled+disabled == 0 {
+		return 0
+	}
+	return float64(enabled) / float64(enabled+disabled)
+}
+
+// LastCheck returns the start time and the duration of the last probe of a server of a backend.
+// ok is false when the server has not been probed yet.
+func (hc *HealthCheck) LastCheck(backendID, serverURL string) (checked time.Time, latency time.Duration, ok bool) {
+	hc.lock.RLock()
+	backend, found := hc.Backends[backendID]
+	hc.lock.RUnlock()
+	if !found {
+		return time.Time{}, 0, false
+	}
+	return backend.lastCheck(serverURL)
+}
+
+// FailureRate returns the share of failed probes among the last probes of a server of a backend,
+// up to 10. ok is false when the server has not been probed yet.
+func (hc *HealthCheck) FailureRate(backendID, serverURL string) (rate float64, ok bool) {
+	hc.lock.RLock()
+	backend, found := hc.Backends[backendID]
+	hc.lock.RUnlock()
+	if !found {
+		return 0, false
+	}
+	backend.lock.RLock()
+	defer backend.lock.RUnlock()
+	state, probed := backend.servers[serverURL]
+	if !probed || state.probes == 0 {
+		return 0, false
+	}
+	return state.failureRate(), true
+}
+
+// BackendStatus is a snapshot of the health check state of a backend and of the timings of its checks.
+type BackendStatus struct {
+	Interval time.Duration
+	Timeout  time.Duration
+	Paused   bool
+	// DisabledURLs are the servers currently removed by the health check.
+	DisabledURLs []string
+	// Servers holds the state of each known server of the backend, by URL.
+	Servers map[string]ServerStatus
+}
+
+// ServerStatus is a snapshot of the health check state of a server.
+type ServerStatus struct {
+	Healthy bool
+	// LastCheck is the start time of the last probe, zero if the server has not been probed yet,
+	// and LastLatency its duration.
+	LastCheck   time.Time
+	LastLatency time.Duration
+	// Failures and Successes are the numbers of consecutive failed and successful probes.
+	Failures  int
+	Successes int
+	// FailureRate is the share of failed probes among the last probes, up to 10.
+	FailureRate float64
+}
+
+// Snapshot returns the state of the health checks of each backend, by backend ID.
+func (hc *HealthCheck) Snapshot() map[string]BackendStatus {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	snapshot := make(map[string]BackendStatus, len(hc.Backends))
+	for backendID, backend := range hc.Backends {
+		status := backend.status()
+		status.Paused = hc.paused[backendID]
+		snapshot[backendID] = status
+	}
+	return snapshot
+}
+
+// status returns a snapshot of the state of the servers of the backend.
+func (b *BackendHealthCheck) status() BackendStatus {
+	servers := b.LB.Servers()
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	status := BackendStatus{
+		Interval:     b.Interval,
+		Timeout:      b.requestTimeout,
+		DisabledURLs: make([]string, 0, len(b.disabledURLs)),
+		Servers:      make(map[string]ServerStatus, len(servers)+len(b.disabledURLs)),
+	}
+	for _, u := range servers {
+		status.Servers[u.String()] = b.serverStatus(u.String(), true)
+	}
+	// With ObserveOnly, the removed servers are still known to the load balancer.
+	for _, u := range b.disabledURLs.sorted() {
+		status.DisabledURLs = append(status.DisabledURLs, u.String())
+		status.Servers[u.String()] = b.serverStatus(u.String(), false)
+	}
+	return status
+}
+
+// serverStatus returns a snapshot of the state of a server, the caller holds b.lock.
+func (b *BackendHealthCheck) serverStatus(serverURL string, healthy bool) ServerStatus {
+	status := ServerStatus{Healthy: healthy}
+	if state, ok := b.servers[serverURL]; ok {
+		status.LastCheck, status.LastLatency = state.lastChecked, state.lastLatency
+		status.Failures, status.Successes = state.failures, state.successes
+		status.FailureRate = state.failureRate()
+	}
+	return status
+}
+
+// lastCheck returns the start time and the duration of the last probe of a server.
+func (b *BackendHealthCheck) lastCheck(serverURL string) (time.Time, time.Duration, bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	state, ok := b.servers[serverURL]
+	if !ok || state.lastChecked.IsZero() {
+		return time.Time{}, 0, false
+	}
+	return state.lastChecked, state.lastLatency, true
+}
+
+// execute starts the check goroutines of backends, the caller holds hc.lock.
+func (hc *HealthCheck) execute(backends map[string]*BackendHealthCheck) {
+	for backendID, backend := range backends {
 		currentBackend := backend
 		currentBackendID := backendID
+		ctx, cancel := context.WithCancel(hc.ctx)
+		hc.running[backendID] = cancel
+		hc.wg.Add(1)
+		safe.Go(func() {
+			defer hc.wg.Done()
+			hc.run(ctx, currentBackendID, currentBackend)
+		})
+	}
+}
+
+func (hc *HealthCheck) run(ctx context.Context, backendID string, backend *BackendHealthCheck) {
+	if backend.InitialJitter && backend.Interval > 0 {
+		delay := time.Duration(rand.Int63n(int64(backend.Interval)))
+		hc.logger().Debugf("Delaying initial healthcheck for backend %s by %s", backendID, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+	if backend.SkipInitialCheck {
+		hc.logger().Debugf("Skipping initial healthcheck for backend %s", backendID)
+	} else {
+		hc.logger().Debugf("Initial healthcheck for backend %s ", backendID)
+		hc.checkBackendUnlessPaused(ctx, backendID, backend)
+	}
+
+	interval := backend.Interval
+	if interval <= 0 {
+		hc.logger().Warnf("Invalid health check interval %s for backend %s, using %s", interval, backendID, DefaultInterval)
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			hc.backendLogger(backendID).Debugf("Stopping all current Healthcheck goroutines")
+			return
+		case <-ticker.C:
+			// The backend may have been replaced by an unchanged instance on a reload.
+			if current := hc.backend(backendID); current != nil {
+				backend = current
+			}
+			hc.logger().Debugf("Refreshing Healthcheck for currentBackend %s ", backendID)
+			hc.checkBackendUnlessPaused(ctx, backendID, backend)
+		}
+	}
+}
+
+// checkBackendUnlessPaused checks a backend, or leaves its servers untouched while it is paused.
+func (hc *HealthCheck) checkBackendUnlessPaused(ctx context.Context, backendID string, backend *BackendHealthCheck) {
+	if hc.Paused(backendID) {
+		hc.logger().Debugf("Skipping Healthcheck of paused backend %s", backendID)
+		return
+	}
+	hc.checkBackend(ctx, backendID, backend)
+}
+
+// checkBackend probes all the servers of a backend and updates the load balancer.
+// The servers are probed concurrently and the results applied once all the probes are done.
+// The sweep is aborted without altering any state if ctx is done.
+// The sweeps of a backend never run concurrently.
+func (hc *HealthCheck) checkBackend(ctx context.Context, backendID string, currentBackend *BackendHealthCheck) {
+	currentBackend.sweep.Lock()
+	defer currentBackend.sweep.Unlock()
+	now := time.Now()
+	enabledURLs := currentBackend.LB.Servers()
+	if currentBackend.serverless(now, enabledURLs) {
+		hc.logger().Warnf("Health checked backend %s has had no server for more than %s, check its configuration", backendID, currentBackend.Interval)
+	}
+	if currentBackend.StartUnhealthy {
+		enabledURLs = hc.holdNewServers(backendID, currentBackend, enabledURLs)
+	}
+	enabledURLs = currentBackend.withoutDisabled(enabledURLs)
+	enabledURLs = hc.ejectForcedDown(backendID, currentBackend, enabledURLs)
+	enabledURLs = hc.holdRestored(backendID, currentBackend, enabledURLs)
+	currentBackend.lock.Lock()
+	total := len(enabledURLs) + len(currentBackend.disabledURLs)
+	newDisabledURLs := make(urlSet)
+	var recheckedURLs []*url.URL
+	for _, url := range currentBackend.disabledURLs.sorted() {
+		if currentBackend.serverState(url).backingOff(now, currentBackend.Interval) {
+			hc.backendLogger(backendID).Debugf("HealthCheck is backing off [%s]", url.String())
+			newDisabledURLs.add(url)
+			continue
+		}
+		recheckedURLs = append(recheckedURLs, url)
+	}
+	currentBackend.lock.Unlock()
+
+	probedURLs := append(append([]*url.URL(nil), recheckedURLs...), enabledURLs...)
+	results := hc.probeAll(ctx, backendID, probedURLs, currentBackend)
+	if ctx.Err() != nil {
+		hc.logger().Debugf("Healthcheck of backend %s canceled", backendID)
+		return
+	}
+
+	for i, url := range recheckedURLs {
+		healthy := results[i] == probeHealthy
+		desiredWeight, hasDesiredWeight := currentBackend.desiredWeight(url)
+		currentBackend.lock.Lock()
+		state := currentBackend.serverState(url)
+		state.record(healthy, now)
+		if hasDesiredWeight {
+			state.weight = desiredWeight
+		}
+		if !healthy && currentBackend.MaxBackoff > 0 {
+			state.increaseBackoff(now, currentBackend.Interval, currentBackend.MaxBackoff)
+		}
+		opened := false
+		if !healthy {
+			state.delayUntilRetryAfter()
+			opened = state.openCircuit(now, currentBackend.CircuitThreshold, currentBackend.CircuitCooldown)
+		}
+		successes, weight := state.successes, state.weight
+		healthyThreshold := currentBackend.HealthyThreshold
+		if state.held && currentBackend.FastAdmission {
+			healthyThreshold = 1
+		}
+		passing := now.Sub(state.passingSince)
+		recovered := successes >= healthyThreshold && passing >= currentBackend.HealthyDuration
+		if healthy && recovered {
+			state.held = false
+		}
+		if healthy && recovered && currentBackend.SlowStart > 0 {
+			state.rampStart = now
+			weight, _ = state.rampWeight(now, currentBackend.SlowStart)
+		} else if healthy && recovered && currentBackend.LoadHeader != "" {
+			state.loadBase = weight
+			weight = state.loadWeight(weight)
+		}
+		currentBackend.lock.Unlock()
+		if opened {
+			hc.backendLogger(backendID).Debugf("HealthCheck circuit is open [%s]: connection refused, not probing it for %s", url.String(), currentBackend.CircuitCooldown)
+		}
+		if !healthy {
+			newDisabledURLs.add(url)
+			hc.getMetrics().setServerUp(backendID, url.String(), false)
+			continue
+		}
+		if successes < healthyThreshold {
+			hc.backendLogger(backendID).Debugf("HealthCheck is recovering [%s]: %d/%d successful checks", url.String(), successes, healthyThreshold)
+			newDisabledURLs.add(url)
+			hc.getMetrics().setServerUp(backendID, url.String(), false)
+			continue
+		}
+		if !recovered {
+			hc.backendLogger(backendID).Debugf("HealthCheck is recovering [%s]: passing for %s out of %s", url.String(), passing, currentBackend.HealthyDuration)
+			newDisabledURLs.add(url)
+			hc.getMetrics().setServerUp(backendID, url.String(), false)
+			continue
+		}
+		if hc.InMaintenance(backendID, url) {
+			hc.backendLogger(backendID).Debugf("HealthCheck is keeping [%s] out of rotation: server is in maintenance", url.String())
+			newDisabledURLs.add(url)
+			hc.getMetrics().setServerUp(backendID, url.String(), false)
+			continue
+		}
+		currentBackend.transitionLog(hc.logger(), backendID, url, stateDown, stateUp).Debugf("HealthCheck is up [%s]: Upsert in server list with weight %d", url.String(), weight)
+		currentBackend.upsertServer(hc.backendLogger(backendID), url, weight)
+		hc.getMetrics().setServerUp(backendID, url.String(), true)
+		hc.publish(Event{BackendID: backendID, URL: url, Labels: currentBackend.ServerLabels[url.String()], Healthy: true, Time: time.Now()})
+	}
+	currentBackend.lock.Lock()
+	currentBackend.disabledURLs = newDisabledURLs
+	currentBackend.lock.Unlock()
+
+	for i, url := range enabledURLs {
+		result := results[len(recheckedURLs)+i]
+		healthy, draining := result == probeHealthy, result == probeDraining
+		currentWeight, desiredWeight, hasDesiredWeight := 0, 0, false
+		if healthy && currentBackend.LoadHeader != "" {
+			currentWeight = serverWeight(currentBackend.LB, url)
+			desiredWeight, hasDesiredWeight = currentBackend.desiredWeight(url)
+		}
+		currentBackend.lock.Lock()
+		state := currentBackend.serverState(url)
+		warmingUp := !healthy && !draining && currentBackend.WarmupGrace > 0 && now.Sub(state.firstSeen) < currentBackend.WarmupGrace
+		if !warmingUp {
+			state.record(healthy, now)
+		}
+		failures, ramping := state.failures, !state.rampStart.IsZero()
+		failing := now.Sub(state.failingSince)
+		rampWeight, stillRamping := 0, false
+		if healthy && ramping {
+			rampWeight, stillRamping = state.rampWeight(now, currentBackend.SlowStart)
+			if !stillRamping {
+				state.rampStart = time.Time{}
+			}
+		}
+		loadWeight := 0
+		if healthy && !ramping && currentBackend.LoadHeader != "" {
+			if hasDesiredWeight {
+				state.loadBase = desiredWeight
+			} else if state.loadBase == 0 {
+				state.loadBase = currentWeight
+			}
+			loadWeight = state.loadWeight(state.loadBase)
+		}
+		currentBackend.lock.Unlock()
+		if healthy {
+			if ramping {
+				hc.backendLogger(backendID).Debugf("HealthCheck is ramping up [%s]: Upsert in server list with weight %d", url.String(), rampWeight)
+				currentBackend.upsertServer(hc.backendLogger(backendID), url, rampWeight)
+			} else if loadWeight > 0 && loadWeight != currentWeight {
+				hc.backendLogger(backendID).Debugf("HealthCheck is reweighting [%s]: Upsert in server list with weight %d for its load", url.String(), loadWeight)
+				currentBackend.upsertServer(hc.backendLogger(backendID), url, loadWeight)
+			}
+			hc.getMetrics().setServerUp(backendID, url.String(), true)
+			continue
+		}
+		if warmingUp {
+			hc.backendLogger(backendID).Debugf("HealthCheck is failing [%s]: Ignored during the warmup grace period", url.String())
+			hc.getMetrics().setServerUp(backendID, url.String(), true)
+			continue
+		}
+		if !draining && failures < currentBackend.UnhealthyThreshold {
+			hc.backendLogger(backendID).Debugf("HealthCheck is failing [%s]: %d/%d failed checks", url.String(), failures, currentBackend.UnhealthyThreshold)
+			hc.getMetrics().setServerUp(backendID, url.String(), true)
+			continue
+		}
+		if !draining && failing < currentBackend.UnhealthyDuration {
+			hc.backendLogger(backendID).Debugf("HealthCheck is failing [%s]: failing for %s out of %s", url.String(), failing, currentBackend.UnhealthyDuration)
+			hc.getMetrics().setServerUp(backendID, url.String(), true)
+			continue
+		}
+		if currentBackend.FailOpen && len(currentBackend.LB.Servers()) <= 1 {
+			hc.logger().Warnf("HealthCheck has failed [%s]: Keeping the last server of backend %s in rotation", url.String(), backendID)
+			hc.getMetrics().setServerUp(backendID, url.String(), true)
+			continue
+		}
+		if !currentBackend.canEject(total) {
+			hc.logger().Warnf("HealthCheck has failed [%s]: Keeping it in rotation, backend %s already has %d%% of its servers removed", url.String(), backendID, currentBackend.MaxEjectionPercent)
+			hc.getMetrics().setServerUp(backendID, url.String(), true)
+			continue
+		}
+		if len(currentBackend.LB.Servers()) <= 1 {
+			hc.notifyEmpty(backendID)
+		}
+		if draining {
+			currentBackend.transitionLog(hc.logger(), backendID, url, stateUp, stateDraining).Infof("HealthCheck is draining [%s]: Remove from server list", url.String())
+		} else {
+			currentBackend.transitionLog(hc.logger(), backendID, url, stateUp, stateDown).Debugf("HealthCheck has failed [%s]: Remove from server list", url.String())
+		}
+		weight := serverWeight(currentBackend.LB, url)
+		currentBackend.removeServer(hc.backendLogger(backendID), url)
+		currentBackend.lock.Lock()
+		state = currentBackend.serverState(url)
+		if ramping {
+			// The load balancer only knows the ramp weight, keep the weight before removal.
+			state.rampStart = time.Time{}
+		} else if state.loadBase > 0 {
+			// The load balancer only knows the weight scaled down by the load.
+			state.weight = state.loadBase
+		} else {
+			state.weight = weight
+		}
+		state.delayUntilRetryAfter()
+		opened := state.openCircuit(now, currentBackend.CircuitThreshold, currentBackend.CircuitCooldown)
+		currentBackend.disabledURLs.add(url)
+		currentBackend.lock.Unlock()
+		if opened {
+			hc.backendLogger(backendID).Debugf("HealthCheck circuit is open [%s]: connection refused, not probing it for %s", url.String(), currentBackend.CircuitCooldown)
+		}
+		hc.getMetrics().setServerUp(backendID, url.String(), false)
+		hc.publish(Event{BackendID: backendID, URL: url, Labels: currentBackend.ServerLabels[url.String()], Healthy: false, Draining: draining, Time: time.Now()})
+	}
+	hc.saveState()
+}
+
+// inherit carries over the health state of the servers the previous instance of a backend knew,
+// removing again from the new load balancer the servers which were removed. The servers added by the
+// new configuration start afresh. It reports whether the backend has the same servers as before.
+// The state is kept even when the servers change: it is no longer reset for a backend whose
+// server set differs from the previous one.
+func (b *BackendHealthCheck) inherit(logger *logrus.Entry, previous *BackendHealthCheck) bool {
+	previous.lock.RLock()
+	previousServers := make(map[string]bool)
+	for _, u := range previous.LB.Servers() {
+		previousServers[u.String()] = true
+	}
+	previousDisabled := make(urlSet, len(previous.disabledURLs))
+	for key, u := range previous.disabledURLs {
+		previousServers[key] = true
+		previousDisabled[key] = u
+	}
+	previousStates := make(map[string]*serverState, len(previous.servers))
+	for key, state := range previous.servers {
+		copied := *state
+		previousStates[key] = &copied
+	}
+	previous.lock.RUnlock()
+
+	servers := b.LB.Servers()
+	same := len(servers) == len(previousServers)
+	disabledURLs := make(urlSet)
+	states := make(map[string]*serverState, len(servers))
+	for _, u := range servers {
+		key := u.String()
+		if !previousServers[key] {
+			same = false
+			continue
+		}
+		state, known := previousStates[key]
+		if known {
+			states[key] = state
+		}
+		if previousDisabled.contains(u) {
+			// The new configuration may have changed the weight of the server.
+			if known {
+				state.weight = serverWeight(b.LB, u)
+			}
+			b.removeServer(logger, u)
+			disabledURLs.add(u)
+		}
+	}
+	b.lock.Lock()
+	b.disabledURLs = disabledURLs
+	b.servers = states
+	b.lock.Unlock()
+	return same
+}
+
+// transitionLog returns a logger carrying the structured fields describing a change of the
+// state of a server: the backend, the server, the old and new states, and the outcome of the last probe.
+func (b *BackendHealthCheck) transitionLog(logger *logrus.Entry, backendID string, u *url.URL, from, to string) *logrus.Entry {
+	fields := logrus.Fields{
+		"backend":  backendID,
+		"server":   u.String(),
+		"oldState": from,
+		"newState": to,
+	}
+	for name, value := range b.ServerLabels[u.String()] {
+		if _, ok := fields[name]; !ok {
+			fields[name] = value
+		}
+	}
+	b.lock.RLock()
+	if state, ok := b.servers[u.String()]; ok {
+		fields["latency"] = state.lastLatency.String()
+		if state.lastStatus != 0 {
+			fields["statusCode"] = state.lastStatus
+		}
+		if state.lastReason != "" {
+			fields["reason"] = state.lastReason
+		}
+	}
+	b.lock.RUnlock()
+	return logger.WithFields(fields)
+}
+
+// recordResponse records the status code and the Retry-After header of the response to the
+// last HTTP probe of a server, resp being nil if the probe got no response.
+func (b *BackendHealthCheck) recordResponse(u *url.URL, resp *http.Response) {
+	var status int
+	var retryAfter time.Time
+	var load float64
+	var loaded bool
+	if resp != nil {
+		status = resp.StatusCode
+		retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if b.LoadHeader != "" {
+			var err error
+			load, err = strconv.ParseFloat(resp.Header.Get(b.LoadHeader), 64)
+			loaded = err == nil && load >= 0 && load <= 1
+		}
+	}
+	b.lock.Lock()
+	state := b.serverState(u)
+	state.lastStatus, state.retryAfter = status, retryAfter
+	state.load, state.loaded = load, loaded
+	b.lock.Unlock()
+}
+
+// recordRefused records whether the connection of the last probe of a server was refused.
+func (b *BackendHealthCheck) recordRefused(u *url.URL, err error) {
+	b.lock.Lock()
+	b.serverState(u).refused = errors.Is(err, syscall.ECONNREFUSED)
+	b.lock.Unlock()
+}
+
+// parseRetryAfter returns the time requested by a Retry-After header, a number of seconds or an
+// HTTP date, capped to maxRetryAfter from now. It returns the zero time for an empty or invalid value.
+func parseRetryAfter(value string, now time.Time) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	var retryAfter time.Time
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return time.Time{}
+		}
+		retryAfter = now.Add(time.Duration(seconds) * time.Second)
+	} else if date, err := http.ParseTime(value); err == nil {
+		retryAfter = date
+	} else {
+		return time.Time{}
+	}
+	if max := now.Add(maxRetryAfter); retryAfter.After(max) {
+		return max
+	}
+	return retryAfter
+}
+
+// canEject reports whether one more server can be removed without exceeding
+// MaxEjectionPercent of the total servers of the backend.
+func (b *BackendHealthCheck) canEject(total int) bool {
+	if b.MaxEjectionPercent <= 0 {
+		return true
+	}
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return (len(b.disabledURLs)+1)*100 <= b.MaxEjectionPercent*total
+}
+
+// serverless tracks since when the backend has neither a server in the load balancer nor a
+// removed server, and reports whether it has been the case for at least one interval.
+func (b *BackendHealthCheck) serverless(now time.Time, servers []*url.URL) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if len(servers) > 0 || len(b.disabledURLs) > 0 {
+		b.emptySince = time.Time{}
+		return false
+	}
+	if b.emptySince.IsZero() {
+		b.emptySince = now
+	}
+	return now.Sub(b.emptySince) >= b.Interval
+}
+
+// holdNewServers removes from the load balancer the servers seen for the first time,
+// so that they are checked as disabled servers, and returns the other servers.
+func (hc *HealthCheck) holdNewServers(backendID string, backend *BackendHealthCheck, urls []*url.URL) []*url.URL {
+	var known []*url.URL
+	for _, url := range urls {
+		backend.lock.RLock()
+		_, seen := backend.servers[url.String()]
+		backend.lock.RUnlock()
+		if seen {
+			known = append(known, url)
+			continue
+		}
+		hc.backendLogger(backendID).Debugf("HealthCheck is holding new server [%s] out of rotation until it passes the check", url.String())
+		weight := serverWeight(backend.LB, url)
+		backend.removeServer(hc.backendLogger(backendID), url)
+		backend.lock.Lock()
+		state := backend.serverState(url)
+		state.weight, state.held = weight, true
+		backend.disabledURLs.add(url)
+		backend.lock.Unlock()
+		hc.getMetrics().setServerUp(backendID, url.String(), false)
+	}
+	return known
+}
+
+// ejectForcedDown removes from the load balancer the servers in maintenance, which are checked
+// as removed servers from then on, and returns the other servers.
+func (hc *HealthCheck) ejectForcedDown(backendID string, backend *BackendHealthCheck, urls []*url.URL) []*url.URL {
+	var kept []*url.URL
+	for _, url := range urls {
+		if !hc.InMaintenance(backendID, url) {
+			kept = append(kept, url)
+			continue
+		}
+		hc.backendLogger(backendID).Infof("HealthCheck is in maintenance [%s]: Remove from server list", url.String())
+		weight := serverWeight(backend.LB, url)
+		backend.removeServer(hc.backendLogger(backendID), url)
+		backend.lock.Lock()
+		backend.serverState(url).weight = weight
+		backend.disabledURLs.add(url)
+		backend.lock.Unlock()
+		hc.getMetrics().setServerUp(backendID, url.String(), false)
+		hc.publish(Event{BackendID: backendID, URL: url, Labels: backend.ServerLabels[url.String()], Healthy: false, Time: time.Now()})
+	}
+	return kept
+}
+
+// probeAll probes the servers with a pool of at most MaxConcurrentChecks, or maxConcurrentProbes, workers,
+// each probe being delayed by its jitter, and returns the results in the order of the servers.
+func (hc *HealthCheck) probeAll(ctx context.Context, backendID string, urls []*url.URL, backend *BackendHealthCheck) []probeResult {
+	results := make([]probeResult, len(urls))
+	hc.lock.RLock()
+	workers := hc.maxConcurrentProbes
+	hc.lock.RUnlock()
+	if backend.MaxConcurrentChecks > 0 {
+		workers = backend.MaxConcurrentChecks
+	}
+	if workers <= 0 || workers > len(urls) {
+		workers = len(urls)
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
 		safe.Go(func() {
-			for {
-				ticker := time.NewTicker(currentBackend.Interval)
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = hc.probe(ctx, backendID, urls[i], backend)
+			}
+		})
+	}
+	delays := probeDelays(len(urls), backend)
+	order := make([]int, len(urls))
+	for i := range order {
+		order[i] = i
+	}
+	if delays != nil {
+		sort.Slice(order, func(a, b int) bool { return delays[order[a]] < delays[order[b]] })
+	}
+	start := time.Now()
+dispatch:
+	for _, i := range order {
+		if delays != nil {
+			if wait := delays[i] - time.Since(start); wait > 0 {
+				timer := time.NewTimer(wait)
 				select {
 				case <-ctx.Done():
-					log.Debugf("Stopping all current Healthcheck goroutines")
-					return
-				case <-ticker.C:
-					log.Debugf("Refreshing Healthcheck for currentBackend %s ", currentBackendID)
-					enabledURLs := currentBackend.lb.Servers()
-					var newDisabledURLs []*url.URL
-					for _, url := range currentBackend.DisabledURLs {
-						if checkHealth(url, currentBackend.URL) {
-							log.Debugf("HealthCheck is up [%s]: Upsert in server list", url.String())
-							currentBackend.lb.UpsertServer(url, roundrobin.Weight(1))
-						} else {
-							newDisabledURLs = append(newDisabledURLs, url)
-						}
-					}
-					currentBackend.DisabledURLs = newDisabledURLs
-
-					for _, url := range enabledURLs {
-						if !checkHealth(url, currentBackend.URL) {
-							log.Debugf("HealthCheck has failed [%s]: Remove from server list", url.String())
-							currentBackend.lb.RemoveServer(url)
-							currentBackend.DisabledURLs = append(currentBackend.DisabledURLs, url)
-						}
-					}
-
+					timer.Stop()
+					break dispatch
+				case <-timer.C:
 				}
 			}
-		})
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// probeDelays returns a random delay of up to Jitter percent of the interval for each of the n
+// probes of a sweep, so that the effective interval of each server varies by up to Jitter percent.
+// It returns nil when the jitter is disabled.
+func probeDelays(n int, backend *BackendHealthCheck) []time.Duration {
+	max := int64(backend.Interval) * int64(backend.Jitter) / 100
+	if max <= 0 {
+		return nil
+	}
+	delays := make([]time.Duration, n)
+	for i := range delays {
+		delays[i] = time.Duration(rand.Int63n(max))
+	}
+	return delays
+}
+
+// probe checks the health of a server and records the outcome in the metrics.
+func (hc *HealthCheck) probe(ctx context.Context, backendID string, serverURL *url.URL, backend *BackendHealthCheck) probeResult {
+	hc.lock.RLock()
+	inFlight := hc.inFlight
+	hc.lock.RUnlock()
+	if inFlight != nil {
+		select {
+		case inFlight <- struct{}{}:
+			defer func() { <-inFlight }()
+		case <-ctx.Done():
+			return probeUnhealthy
+		}
+	}
+	start := time.Now()
+	outcome := checkServer(withLogger(ctx, hc.backendLogger(backendID)), serverURL, backend)
+	latency := time.Since(start)
+	backend.lock.Lock()
+	state := backend.serverState(serverURL)
+	state.lastChecked, state.lastLatency = start, latency
+	state.smoothedLatency = smoothLatency(state.smoothedLatency, latency)
+	smoothed := state.smoothedLatency
+	backend.lock.Unlock()
+	if outcome.result == probeHealthy && backend.MaxLatency > 0 && smoothed > backend.MaxLatency {
+		hc.backendLogger(backendID).Debugf("HealthCheck is slow [%s]: smoothed latency %s exceeds %s", serverURL.String(), smoothed, backend.MaxLatency)
+		outcome = failed(reasonSlow)
+	}
+	if outcome.result == probeHealthy && backend.DeepURL != "" {
+		outcome = backend.checkDeep(withLogger(ctx, hc.backendLogger(backendID)), serverURL)
+	}
+	backend.lock.Lock()
+	state = backend.serverState(serverURL)
+	state.recordOutcome(outcome.result == probeUnhealthy)
+	state.lastReason = outcome.reason
+	failureRate := state.failureRate()
+	backend.lock.Unlock()
+	metrics := hc.getMetrics()
+	metrics.observeProbe(backendID, serverURL.String(), latency.Seconds(), outcome)
+	metrics.setSmoothedLatency(backendID, serverURL.String(), smoothed.Seconds())
+	metrics.setFailureRate(backendID, serverURL.String(), failureRate)
+	metrics.setServerLabels(backendID, serverURL.String(), backend.ServerLabels[serverURL.String()])
+	return outcome.result
+}
+
+// checkDeep returns the result of the last deep probe of a server, probing DeepURL again once
+// DeepInterval has elapsed since.
+func (b *BackendHealthCheck) checkDeep(ctx context.Context, serverURL *url.URL) probeOutcome {
+	b.lock.RLock()
+	state := b.servers[serverURL.String()]
+	due := state == nil || state.deepChecked.IsZero() || time.Since(state.deepChecked) >= b.DeepInterval
+	var outcome probeOutcome
+	if state != nil {
+		outcome = state.deepResult
+	}
+	b.lock.RUnlock()
+	if !due {
+		return outcome
+	}
+	outcome = checkHTTPEndpoint(ctx, serverURL, b, b.DeepURL)
+	if outcome.result != probeHealthy {
+		contextLogger(ctx).Debugf("HealthCheck deep probe of [%s] failed: %s", serverURL.String(), outcome.reason)
+	}
+	b.lock.Lock()
+	state = b.serverState(serverURL)
+	state.deepChecked, state.deepResult = time.Now(), outcome
+	b.lock.Unlock()
+	return outcome
+}
+
+// smoothLatency adds the latency of a probe to the smoothed latency of a server, which is
+// zero before its first probe.
+func smoothLatency(smoothed, latency time.Duration) time.Duration {
+	if smoothed == 0 {
+		return latency
+	}
+	return time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(smoothed))
+}
+
+// serverWeight returns the current weight of a server, defaulting to 1 when the
+// load balancer does not expose it.
+func serverWeight(lb LoadBalancer, u *url.URL) int {
+	if weighted, ok := lb.(weightedLoadBalancer); ok {
+		if weight, ok := weighted.ServerWeight(u); ok && weight > 0 {
+			return weight
+		}
+	}
+	return 1
+}
+
+// desiredWeight returns the weight the configuration currently intends for a server, if known.
+func (b *BackendHealthCheck) desiredWeight(u *url.URL) (int, bool) {
+	if b.DesiredWeight == nil {
+		return 0, false
+	}
+	weight, ok := b.DesiredWeight(u)
+	return weight, ok && weight > 0
+}
+
+// checkServer probes a server, retrying the failed probes up to Retries times.
+func checkServer(ctx context.Context, serverURL *url.URL, backend *BackendHealthCheck) probeOutcome {
+	for attempt := 0; ; attempt++ {
+		outcome := checkOnce(ctx, serverURL, backend)
+		if outcome.result != probeUnhealthy || attempt >= backend.Retries {
+			return outcome
+		}
+		delay := retryBackoff << uint(attempt)
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)))
+		contextLogger(ctx).Debugf("HealthCheck probe of [%s] failed: %s, retrying in %s", serverURL.String(), outcome.reason, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return outcome
+		case <-timer.C:
+		}
+	}
+}
+
+// checkOnce probes a server with the configured mode.
+func checkOnce(ctx context.Context, serverURL *url.URL, backend *BackendHealthCheck) probeOutcome {
+	if backend.ProbeFunc != nil {
+		ctx, cancel := context.WithTimeout(ctx, backend.requestTimeout)
+		defer cancel()
+		return outcomeOf(backend.ProbeFunc(ctx, serverURL), reasonFailed)
+	}
+	switch backend.Mode {
+	case ModeTCP:
+		return checkTCP(ctx, serverURL, backend)
+	case ModeGRPC:
+		return outcomeOf(checkGRPC(ctx, serverURL, backend), reasonFailed)
+	case ModeUDP:
+		return outcomeOf(checkUDP(ctx, serverURL, backend), reasonFailed)
+	case ModeExec:
+		return outcomeOf(checkExec(ctx, serverURL, backend), reasonFailed)
+	default:
+		return checkHTTP(ctx, serverURL, backend)
+	}
+}
+
+// checkTCP considers a server healthy if a TCP connection can be established to it.
+func checkTCP(ctx context.Context, serverURL *url.URL, backend *BackendHealthCheck) probeOutcome {
+	conn, err := backend.dialContext(ctx, "tcp", hostPort(probeTarget(serverURL, backend)))
+	backend.recordRefused(serverURL, err)
+	if err != nil {
+		return failed(classifyError(err))
 	}
+	conn.Close()
+	return probeOutcome{result: probeHealthy}
 }
 
-func checkHealth(serverURL *url.URL, checkURL string) bool {
-	timeout := time.Duration(5 * time.Second)
-	client := http.Client{
-		Timeout: timeout,
+// hostPort returns the host:port address of a server, using the scheme default port if needed.
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
 	}
-	resp, err := client.Get(serverURL.String() + checkURL)
-	if err != nil || resp.StatusCode != 200 {
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// probeTarget returns the server URL with the scheme and port overrides applied.
+func probeTarget(serverURL *url.URL, backend *BackendHealthCheck) *url.URL {
+	u := *serverURL
+	if backend.Scheme != "" {
+		u.Scheme = backend.Scheme
+	}
+	if port := backend.ServerPorts[serverURL.String()]; port > 0 {
+		u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(port))
+	} else if backend.Port > 0 {
+		u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(backend.Port))
+	}
+	return &u
+}
+
+// probeURL builds the URL of a health endpoint of a server, appending the path to the one of
+// the server URL. The URL is assembled field by field to keep the IPv6 hosts bracketed.
+func probeURL(serverURL *url.URL, backend *BackendHealthCheck, path string) string {
+	u := probeTarget(serverURL, backend)
+	endpoint, err := url.Parse(probePath(serverURL, path))
+	if err != nil {
+		return u.String() + probePath(serverURL, path)
+	}
+	escapedPath := u.EscapedPath() + endpoint.EscapedPath()
+	u.Path += endpoint.Path
+	u.RawPath = escapedPath
+	u.RawQuery = endpoint.RawQuery
+	u.Fragment = ""
+	return u.String()
+}
+
+// healthPath returns the path of the health endpoint of a server for the scheme it is probed with.
+func healthPath(serverURL *url.URL, backend *BackendHealthCheck) string {
+	if path, ok := backend.SchemeURLs[probeTarget(serverURL, backend).Scheme]; ok {
+		return path
+	}
+	return backend.URL
+}
+
+// probePath resolves the placeholders of the health endpoint path for a server.
+func probePath(serverURL *url.URL, path string) string {
+	if !strings.Contains(path, "{") {
+		return path
+	}
+	host, port, _ := net.SplitHostPort(hostPort(serverURL))
+	return strings.NewReplacer("{host}", host, "{port}", port).Replace(path)
+}
+
+// checkHTTP probes the health endpoints of a server in turn and combines their results with
+// the Require rule. A server is draining if no endpoint is healthy, or all endpoints are
+// required, and an endpoint reports a drain status.
+func checkHTTP(ctx context.Context, serverURL *url.URL, backend *BackendHealthCheck) probeOutcome {
+	path := healthPath(serverURL, backend)
+	if len(backend.URLs) == 0 {
+		return checkHTTPEndpoint(ctx, serverURL, backend, path)
+	}
+	var outcome probeOutcome
+	for _, path := range append([]string{path}, backend.URLs...) {
+		endpoint := checkHTTPEndpoint(ctx, serverURL, backend, path)
+		switch endpoint.result {
+		case probeHealthy:
+			if backend.Require == RequireAny {
+				return endpoint
+			}
+			outcome = endpoint
+		case probeDraining:
+			if backend.Require != RequireAny {
+				return endpoint
+			}
+			outcome = endpoint
+		default:
+			if backend.Require != RequireAny {
+				return endpoint
+			}
+			if outcome.result == probeUnhealthy {
+				// Keep the reason of the last failure if no endpoint is healthy or draining.
+				outcome = endpoint
+			}
+		}
+	}
+	return outcome
+}
+
+// checkHTTPEndpoint probes one health endpoint of a server.
+func checkHTTPEndpoint(ctx context.Context, serverURL *url.URL, backend *BackendHealthCheck, path string) probeOutcome {
+	method := backend.Method
+	var body io.Reader
+	if backend.Body != "" {
+		body = strings.NewReader(backend.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, probeURL(serverURL, backend, path), body)
+	if err != nil {
+		return failed(reasonRequest)
+	}
+	if backend.Body != "" && backend.ContentType != "" {
+		req.Header.Set("Content-Type", backend.ContentType)
+	}
+	userAgent := backend.UserAgent
+	if userAgent == "" {
+		userAgent = "Traefik-HealthCheck/" + version.Version
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if backend.Accept != "" {
+		req.Header.Set("Accept", backend.Accept)
+	}
+	if backend.Username != "" {
+		req.SetBasicAuth(backend.Username, string(backend.Password))
+	}
+	for name, value := range backend.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	resp, err := backend.client.Do(req)
+	backend.recordRefused(serverURL, err)
+	if err != nil {
+		backend.recordResponse(serverURL, nil)
+		return failed(classifyError(err))
+	}
+	defer closeBody(resp.Body)
+	backend.recordResponse(serverURL, resp)
+	if !certificateValid(ctx, resp.TLS, serverURL, backend) {
+		return failed(reasonCertificate)
+	}
+	if backend.CheckFunc != nil {
+		return outcomeOf(backend.CheckFunc(resp), reasonFailed)
+	}
+	if len(backend.DrainStatus) > 0 && backend.DrainStatus.Contains(resp.StatusCode) {
+		return probeOutcome{result: probeDraining}
+	}
+	if !backend.ExpectedStatus.Contains(resp.StatusCode) {
+		return failed(reasonBadStatus + ":" + strconv.Itoa(resp.StatusCode))
+	}
+	if !matchHeaders(resp.Header, backend.ExpectedHeaders) {
+		return failed(reasonHeaders)
+	}
+	return outcomeOf(matchBody(resp.Body, backend), reasonBody)
+}
+
+// certificateValid reports whether the certificate presented by a server remains valid for
+// at least MinCertValidity. Plain HTTP responses are always valid.
+func certificateValid(ctx context.Context, state *tls.ConnectionState, serverURL *url.URL, backend *BackendHealthCheck) bool {
+	if backend.MinCertValidity <= 0 || state == nil || len(state.PeerCertificates) == 0 {
+		return true
+	}
+	notAfter := state.PeerCertificates[0].NotAfter
+	if time.Until(notAfter) < backend.MinCertValidity {
+		contextLogger(ctx).Warnf("HealthCheck certificate of [%s] expires on %s, in less than %s", serverURL.String(), notAfter.Format(time.RFC3339), backend.MinCertValidity)
 		return false
 	}
 	return true
 }
+
+// matchHeaders reports whether the response headers have the expected values.
+func matchHeaders(header http.Header, expected map[string]string) bool {
+	for name, value := range expected {
+		if header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// matchBody reports whether the beginning of the response body matches the
+// expected substring and regular expression, if any.
+func matchBody(body io.Reader, backend *BackendHealthCheck) bool {
+	if backend.ExpectedBody == "" && backend.ExpectedBodyRegexp == nil {
+		return true
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(body, maxBodySize))
+	if err != nil {
+		return false
+	}
+	if backend.ExpectedBody != "" && !bytes.Contains(content, []byte(backend.ExpectedBody)) {
+		return false
+	}
+	if backend.ExpectedBodyRegexp != nil && !backend.ExpectedBodyRegexp.Match(content) {
+		return false
+	}
+	return true
+}
+
+// closeBody drains a bounded amount of the response body so that the
+// underlying connection can be reused, then closes it.
+func closeBody(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, io.LimitReader(body, maxDrainSize))
+	body.Close()
+}
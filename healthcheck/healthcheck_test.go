@@ -0,0 +1,2389 @@
+package healthcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/containous/traefik/log"
+	"github.com/containous/traefik/version"
+)
+
+// checkHealth reports whether a server passes the probes of a backend, retries included.
+func checkHealth(ctx context.Context, serverURL *url.URL, backend *BackendHealthCheck) bool {
+	return checkServer(ctx, serverURL, backend).result == probeHealthy
+}
+
+func newTestServer(status int) *httptest.Server {
+	return newTestServerFunc(func() int { return status })
+}
+
+func newTestServerFunc(status func() int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status())
+	}))
+}
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("failed to parse URL %s: %s", rawURL, err)
+	}
+	return u
+}
+
+func TestCheckHealthExpectedStatus(t *testing.T) {
+	cases := []struct {
+		desc           string
+		status         int
+		expectedStatus StatusCodes
+		healthy        bool
+	}{
+		{
+			desc:    "default accepts 200",
+			status:  http.StatusOK,
+			healthy: true,
+		},
+		{
+			desc:    "default rejects 204",
+			status:  http.StatusNoContent,
+			healthy: false,
+		},
+		{
+			desc:           "custom set accepts 204",
+			status:         http.StatusNoContent,
+			expectedStatus: StatusCodes{{Min: 200, Max: 200}, {Min: 204, Max: 204}},
+			healthy:        true,
+		},
+		{
+			desc:           "custom set rejects 500",
+			status:         http.StatusInternalServerError,
+			expectedStatus: StatusCodes{{Min: 200, Max: 399}},
+			healthy:        false,
+		},
+	}
+
+	for _, c := range cases {
+		ts := newTestServer(c.status)
+		backend := NewBackendHealthCheck(Options{URL: "/health", ExpectedStatus: c.expectedStatus})
+		if healthy := checkHealth(context.Background(), mustParseURL(t, ts.URL), backend); healthy != c.healthy {
+			t.Errorf("%s: got healthy=%t, expected %t", c.desc, healthy, c.healthy)
+		}
+		ts.Close()
+	}
+}
+
+func TestCheckHealthMethod(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	serverURL := mustParseURL(t, ts.URL)
+	if checkHealth(context.Background(), serverURL, NewBackendHealthCheck(Options{URL: "/health"})) {
+		t.Error("expected the default GET probe to fail")
+	}
+	if !checkHealth(context.Background(), serverURL, NewBackendHealthCheck(Options{URL: "/health", Method: http.MethodHead})) {
+		t.Error("expected the HEAD probe to succeed")
+	}
+}
+
+func TestCheckHealthRedirects(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	serverURL := mustParseURL(t, ts.URL)
+	if checkHealth(context.Background(), serverURL, NewBackendHealthCheck(Options{URL: "/health"})) {
+		t.Error("expected the redirect to be evaluated as is by default")
+	}
+	if !checkHealth(context.Background(), serverURL, NewBackendHealthCheck(Options{URL: "/health", ExpectedStatus: StatusCodes{{Min: 302, Max: 302}}})) {
+		t.Error("expected the redirect status to be accepted when expected")
+	}
+	if !checkHealth(context.Background(), serverURL, NewBackendHealthCheck(Options{URL: "/health", FollowRedirects: true})) {
+		t.Error("expected the redirect to be followed")
+	}
+}
+
+func TestCheckHealthReusesConnections(t *testing.T) {
+	var connections int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	serverURL := mustParseURL(t, ts.URL)
+	backend := NewBackendHealthCheck(Options{URL: "/health"})
+	defer backend.closeIdleConnections()
+	for i := 0; i < 3; i++ {
+		if !checkHealth(context.Background(), serverURL, backend) {
+			t.Fatal("expected the probe to succeed")
+		}
+	}
+	if n := atomic.LoadInt32(&connections); n != 1 {
+		t.Errorf("expected a single connection to be used, got %d", n)
+	}
+}
+
+// countCalls counts the upserts, or the removals, made to a fake load balancer.
+func countCalls(lb *FakeLoadBalancer, upsert bool) int {
+	var count int
+	for _, call := range lb.Calls() {
+		if call.Upsert == upsert {
+			count++
+		}
+	}
+	return count
+}
+
+func TestCheckBackendThresholds(t *testing.T) {
+	var status int32 = http.StatusInternalServerError
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer ts.Close()
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	backend := NewBackendHealthCheck(Options{
+		URL:                "/health",
+		UnhealthyThreshold: 2,
+		HealthyThreshold:   3,
+		LB:                 lb,
+	})
+	defer backend.closeIdleConnections()
+	hc := New()
+
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 1 {
+		t.Fatal("server should not be removed after a single failure")
+	}
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 0 {
+		t.Fatal("server should be removed after two consecutive failures")
+	}
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	hc.checkBackend(context.Background(), "backend", backend)
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 0 {
+		t.Fatal("server should not be re-added before three consecutive successes")
+	}
+
+	// a failure resets the success counter
+	atomic.StoreInt32(&status, http.StatusInternalServerError)
+	hc.checkBackend(context.Background(), "backend", backend)
+	atomic.StoreInt32(&status, http.StatusOK)
+	hc.checkBackend(context.Background(), "backend", backend)
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 0 {
+		t.Fatal("success counter should have been reset by the failure")
+	}
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 1 {
+		t.Fatal("server should be re-added after three consecutive successes")
+	}
+}
+
+func TestCheckBackendBackoff(t *testing.T) {
+	var status, hits int32 = http.StatusInternalServerError, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer ts.Close()
+
+	serverURL := mustParseURL(t, ts.URL)
+	lb := NewFakeLoadBalancer(serverURL)
+	backend := NewBackendHealthCheck(Options{
+		URL:        "/health",
+		Interval:   time.Hour,
+		MaxBackoff: 3 * time.Hour,
+		LB:         lb,
+	})
+	defer backend.closeIdleConnections()
+	hc := New()
+
+	// expire lets the next check probe the server as if its backoff had elapsed.
+	expire := func() {
+		backend.lock.Lock()
+		backend.serverState(serverURL).nextCheck = time.Time{}
+		backend.lock.Unlock()
+	}
+	currentBackoff := func() time.Duration {
+		backend.lock.RLock()
+		defer backend.lock.RUnlock()
+		return backend.serverState(serverURL).backoff
+	}
+
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 0 {
+		t.Fatal("server should be removed after a failure")
+	}
+	for _, expected := range []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour} {
+		hc.checkBackend(context.Background(), "backend", backend)
+		if backoff := currentBackoff(); backoff != expected {
+			t.Fatalf("expected a backoff of %s, got %s", expected, backoff)
+		}
+		expire()
+	}
+
+	atomic.StoreInt32(&hits, 0)
+	hc.checkBackend(context.Background(), "backend", backend)
+	hc.checkBackend(context.Background(), "backend", backend)
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Fatalf("expected the server to be probed once while backing off, got %d probes", n)
+	}
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	expire()
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 1 {
+		t.Fatal("server should be re-added once it recovers")
+	}
+	if backoff := currentBackoff(); backoff != 0 {
+		t.Errorf("expected the backoff to be reset after recovery, got %s", backoff)
+	}
+}
+
+func TestCheckBackendFailOpen(t *testing.T) {
+	var status int32 = http.StatusInternalServerError
+	recovering := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer recovering.Close()
+	failing := newTestServer(http.StatusInternalServerError)
+	defer failing.Close()
+
+	recoveringURL, failingURL := mustParseURL(t, recovering.URL), mustParseURL(t, failing.URL)
+	lb := NewFakeLoadBalancer(recoveringURL, failingURL)
+	backend := NewBackendHealthCheck(Options{URL: "/health", FailOpen: true, LB: lb})
+	defer backend.closeIdleConnections()
+	hc := New()
+
+	hc.checkBackend(context.Background(), "backend", backend)
+	if !reflect.DeepEqual(lb.Servers(), []*url.URL{failingURL}) {
+		t.Fatalf("expected only the last server to be kept in rotation, got %v", lb.Servers())
+	}
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	hc.checkBackend(context.Background(), "backend", backend)
+	if !reflect.DeepEqual(lb.Servers(), []*url.URL{recoveringURL}) {
+		t.Fatalf("expected the failing server to be removed once a sibling recovered, got %v", lb.Servers())
+	}
+}
+
+func TestCheckBackendStartUnhealthy(t *testing.T) {
+	healthy := newTestServer(http.StatusOK)
+	defer healthy.Close()
+	unhealthy := newTestServer(http.StatusInternalServerError)
+	defer unhealthy.Close()
+
+	healthyURL, unhealthyURL := mustParseURL(t, healthy.URL), mustParseURL(t, unhealthy.URL)
+	lb := NewFakeLoadBalancer(healthyURL)
+	backend := NewBackendHealthCheck(Options{URL: "/health", StartUnhealthy: true, UnhealthyThreshold: 3, LB: lb})
+	defer backend.closeIdleConnections()
+	hc := New()
+
+	hc.checkBackend(context.Background(), "backend", backend)
+	if !reflect.DeepEqual(lb.Servers(), []*url.URL{healthyURL}) || countCalls(lb, false) != 1 || countCalls(lb, true) != 1 {
+		t.Fatalf("expected the new server to be held out until it passed the check, got %v (%d removed, %d upserted)", lb.Servers(), countCalls(lb, false), countCalls(lb, true))
+	}
+
+	// a server added after the checks started is held out regardless of the unhealthy threshold
+	lb.SetServers(append(lb.Servers(), unhealthyURL)...)
+	hc.checkBackend(context.Background(), "backend", backend)
+	if !reflect.DeepEqual(lb.Servers(), []*url.URL{healthyURL}) {
+		t.Fatalf("expected the failing new server to be held out, got %v", lb.Servers())
+	}
+	if status := backend.disabledServers(); !reflect.DeepEqual(status, []string{unhealthy.URL}) {
+		t.Errorf("expected the failing new server to be disabled, got %v", status)
+	}
+}
+
+func TestCheckBackendObserveOnly(t *testing.T) {
+	var status int32 = http.StatusInternalServerError
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer ts.Close()
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	backend := NewBackendHealthCheck(Options{URL: "/health", ObserveOnly: true, LB: lb})
+	defer backend.closeIdleConnections()
+	hc := New()
+
+	hc.checkBackend(context.Background(), "backend", backend)
+	hc.checkBackend(context.Background(), "backend", backend)
+	if status := backend.disabledServers(); !reflect.DeepEqual(status, []string{ts.URL}) {
+		t.Errorf("expected the failing server to be reported once as disabled, got %v", status)
+	}
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	hc.checkBackend(context.Background(), "backend", backend)
+	if status := backend.disabledServers(); len(status) != 0 {
+		t.Errorf("expected the recovered server to be reported as enabled, got %v", status)
+	}
+	if len(lb.Servers()) != 1 || countCalls(lb, false) != 0 || countCalls(lb, true) != 0 {
+		t.Errorf("expected the load balancer to be left untouched, got %d removed and %d upserted", countCalls(lb, false), countCalls(lb, true))
+	}
+}
+
+func TestCheckBackendPreservesWeight(t *testing.T) {
+	var status int32 = http.StatusInternalServerError
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer ts.Close()
+
+	lb := NewFakeLoadBalancer()
+	serverURL := mustParseURL(t, ts.URL)
+	lb.UpsertServer(serverURL, 7)
+	backend := NewBackendHealthCheck(Options{URL: "/health", LB: lb})
+	defer backend.closeIdleConnections()
+	hc := New()
+
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 0 {
+		t.Fatal("server should have been removed")
+	}
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	hc.checkBackend(context.Background(), "backend", backend)
+	weight, ok := lb.ServerWeight(serverURL)
+	if !ok {
+		t.Fatal("server should have been re-added")
+	}
+	if weight != 7 {
+		t.Errorf("expected weight 7 to be restored, got %d", weight)
+	}
+}
+
+func TestCheckBackendDesiredWeight(t *testing.T) {
+	var status int32 = http.StatusInternalServerError
+	ts := newTestServerFunc(func() int { return int(atomic.LoadInt32(&status)) })
+	defer ts.Close()
+
+	lb := NewFakeLoadBalancer()
+	serverURL := mustParseURL(t, ts.URL)
+	lb.UpsertServer(serverURL, 7)
+	var desired int32 = 7
+	backend := NewBackendHealthCheck(Options{URL: "/health", LB: lb, DesiredWeight: func(u *url.URL) (int, bool) {
+		return int(atomic.LoadInt32(&desired)), u.String() == serverURL.String()
+	}})
+	defer backend.closeIdleConnections()
+	hc := New()
+
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 0 {
+		t.Fatal("server should have been removed")
+	}
+
+	// the provider changes the weight of the server while it is removed
+	atomic.StoreInt32(&desired, 3)
+	atomic.StoreInt32(&status, http.StatusOK)
+	hc.checkBackend(context.Background(), "backend", backend)
+	if weight, ok := lb.ServerWeight(serverURL); !ok || weight != 3 {
+		t.Errorf("expected the server to be put back with its desired weight 3, got %d", weight)
+	}
+}
+
+func TestCheckBackendDurations(t *testing.T) {
+	var status int32 = http.StatusInternalServerError
+	ts := newTestServerFunc(func() int { return int(atomic.LoadInt32(&status)) })
+	defer ts.Close()
+
+	serverURL := mustParseURL(t, ts.URL)
+	lb := NewFakeLoadBalancer(serverURL)
+	backend := NewBackendHealthCheck(Options{URL: "/health", LB: lb, UnhealthyDuration: time.Minute, HealthyDuration: time.Minute})
+	defer backend.closeIdleConnections()
+	hc := New()
+	rewind := func(since func(*serverState) *time.Time) {
+		backend.lock.Lock()
+		*since(backend.serverState(serverURL)) = time.Now().Add(-2 * time.Minute)
+		backend.lock.Unlock()
+	}
+
+	hc.checkBackend(context.Background(), "backend", backend)
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 1 {
+		t.Fatal("expected the server to be kept in rotation before failing for the unhealthy duration")
+	}
+	rewind(func(s *serverState) *time.Time { return &s.failingSince })
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 0 {
+		t.Fatal("expected the server to be removed after failing for the unhealthy duration")
+	}
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	hc.checkBackend(context.Background(), "backend", backend)
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 0 {
+		t.Fatal("expected the server to be held out of rotation before passing for the healthy duration")
+	}
+	rewind(func(s *serverState) *time.Time { return &s.passingSince })
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 1 {
+		t.Error("expected the server to be re-added after passing for the healthy duration")
+	}
+}
+
+func TestCheckBackendLoadHeader(t *testing.T) {
+	var status int32 = http.StatusOK
+	var load atomic.Value
+	load.Store("0.8")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Load", load.Load().(string))
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer ts.Close()
+
+	lb := NewFakeLoadBalancer()
+	serverURL := mustParseURL(t, ts.URL)
+	lb.UpsertServer(serverURL, 10)
+	backend := NewBackendHealthCheck(Options{URL: "/health", LB: lb, LoadHeader: "X-Load"})
+	defer backend.closeIdleConnections()
+	hc := New()
+	assertWeight := func(expected int) {
+		if weight, ok := lb.ServerWeight(serverURL); !ok || weight != expected {
+			t.Errorf("expected weight %d, got %d (in rotation: %t)", expected, weight, ok)
+		}
+	}
+
+	hc.checkBackend(context.Background(), "backend", backend)
+	assertWeight(2)
+
+	load.Store("overloaded")
+	hc.checkBackend(context.Background(), "backend", backend)
+	assertWeight(10)
+
+	atomic.StoreInt32(&status, http.StatusInternalServerError)
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 0 {
+		t.Fatal("server should have been removed")
+	}
+
+	load.Store("0.5")
+	atomic.StoreInt32(&status, http.StatusOK)
+	hc.checkBackend(context.Background(), "backend", backend)
+	assertWeight(5)
+}
+
+func TestCheckBackendCircuit(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverURL := mustParseURL(t, "http://"+listener.Addr().String())
+	listener.Close()
+
+	lb := NewFakeLoadBalancer(serverURL)
+	backend := NewBackendHealthCheck(Options{URL: "/health", Interval: time.Minute, LB: lb, CircuitThreshold: 2, CircuitCooldown: time.Hour})
+	defer backend.closeIdleConnections()
+	hc := New()
+	lastChecked := func() time.Time {
+		checked, _, _ := backend.lastCheck(serverURL.String())
+		return checked
+	}
+
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 0 {
+		t.Fatal("server should have been removed")
+	}
+	hc.checkBackend(context.Background(), "backend", backend)
+	opened := lastChecked()
+	hc.checkBackend(context.Background(), "backend", backend)
+	if checked := lastChecked(); !checked.Equal(opened) {
+		t.Fatal("expected the server not to be probed while its circuit is open")
+	}
+
+	// the cooldown elapses: a trial probe is refused again and opens the circuit again
+	backend.lock.Lock()
+	backend.serverState(serverURL).nextCheck = time.Now()
+	backend.lock.Unlock()
+	hc.checkBackend(context.Background(), "backend", backend)
+	trial := lastChecked()
+	if !trial.After(opened) {
+		t.Fatal("expected a trial probe once the cooldown elapsed")
+	}
+	hc.checkBackend(context.Background(), "backend", backend)
+	if checked := lastChecked(); !checked.Equal(trial) {
+		t.Error("expected the circuit to open again after a refused trial probe")
+	}
+}
+
+func TestCheckBackendFastAdmission(t *testing.T) {
+	var status int32 = http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer ts.Close()
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	backend := NewBackendHealthCheck(Options{URL: "/health", StartUnhealthy: true, FastAdmission: true, HealthyThreshold: 3, LB: lb})
+	defer backend.closeIdleConnections()
+	hc := New()
+
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 1 || countCalls(lb, false) != 1 {
+		t.Fatal("expected the new server to be held out of rotation until its first success")
+	}
+
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	hc.checkBackend(context.Background(), "backend", backend)
+	atomic.StoreInt32(&status, http.StatusOK)
+	for i := 0; i < 2; i++ {
+		hc.checkBackend(context.Background(), "backend", backend)
+		if len(lb.Servers()) != 0 {
+			t.Fatalf("expected the removed server to wait for the healthy threshold, re-added after %d successes", i+1)
+		}
+	}
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 1 {
+		t.Fatal("expected the removed server to be re-added after the healthy threshold")
+	}
+}
+
+func TestSkipInitialCheck(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	backend := NewBackendHealthCheck(Options{URL: "/health", Interval: time.Hour, SkipInitialCheck: true, LB: lb})
+	defer backend.closeIdleConnections()
+	hc := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	hc.SetBackendsConfiguration(ctx, map[string]*BackendHealthCheck{"backend": backend})
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := hc.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&hits); n != 0 || len(lb.Servers()) != 1 {
+		t.Errorf("expected the server to be kept without being probed before the first interval, got %d probes", n)
+	}
+}
+
+func TestMaxInFlightProbes(t *testing.T) {
+	var inFlight, maxInFlight int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	hc := New()
+	hc.SetMaxInFlightProbes(2)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		var servers []*url.URL
+		for j := 0; j < 3; j++ {
+			servers = append(servers, mustParseURL(t, fmt.Sprintf("%s/%d", ts.URL, j)))
+		}
+		backend := NewBackendHealthCheck(Options{URL: "/health", LB: NewFakeLoadBalancer(servers...)})
+		defer backend.closeIdleConnections()
+		wg.Add(1)
+		go func(backendID string) {
+			defer wg.Done()
+			hc.checkBackend(context.Background(), backendID, backend)
+		}(fmt.Sprintf("backend%d", i))
+	}
+	wg.Wait()
+	if max := atomic.LoadInt32(&maxInFlight); max != 2 {
+		t.Errorf("expected at most 2 probes in flight across the backends, got %d", max)
+	}
+}
+
+func TestFailureRate(t *testing.T) {
+	state := &serverState{}
+	if rate := state.failureRate(); rate != 0 {
+		t.Errorf("expected no failure before the first probe, got %v", rate)
+	}
+	state.recordOutcome(true)
+	state.recordOutcome(false)
+	if rate := state.failureRate(); rate != 0.5 {
+		t.Errorf("got %v, expected 0.5", rate)
+	}
+	for i := 0; i < failureRateWindow-1; i++ {
+		state.recordOutcome(false)
+	}
+	if rate := state.failureRate(); rate != 0 {
+		t.Errorf("expected the failures older than the window to be forgotten, got %v", rate)
+	}
+}
+
+func TestHealthCheckFailureRate(t *testing.T) {
+	var status int32 = http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer ts.Close()
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	backend := NewBackendHealthCheck(Options{URL: "/health", UnhealthyThreshold: 10, LB: lb})
+	defer backend.closeIdleConnections()
+	hc := New()
+	hc.Backends = map[string]*BackendHealthCheck{"backend": backend}
+
+	if _, ok := hc.FailureRate("backend", ts.URL); ok {
+		t.Fatal("expected no failure rate before the first probe")
+	}
+	for i := 0; i < 4; i++ {
+		if i == 3 {
+			atomic.StoreInt32(&status, http.StatusInternalServerError)
+		}
+		hc.checkBackend(context.Background(), "backend", backend)
+	}
+	if rate, ok := hc.FailureRate("backend", ts.URL); !ok || rate != 0.25 {
+		t.Errorf("got failure rate %v (%t), expected 0.25", rate, ok)
+	}
+}
+
+func TestCheckBackendMaintenance(t *testing.T) {
+	ts := newTestServer(http.StatusOK)
+	defer ts.Close()
+	serverURL := mustParseURL(t, ts.URL)
+
+	lb := NewFakeLoadBalancer(serverURL)
+	backend := NewBackendHealthCheck(Options{URL: "/health", LB: lb})
+	defer backend.closeIdleConnections()
+	hc := New()
+
+	hc.StartMaintenance("backend", serverURL)
+	if !hc.InMaintenance("backend", serverURL) {
+		t.Fatal("expected the server to be in maintenance")
+	}
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 0 {
+		t.Fatal("expected the healthy server in maintenance to be removed")
+	}
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 0 {
+		t.Fatal("expected the healthy server in maintenance not to be re-added")
+	}
+
+	hc.EndMaintenance("backend", serverURL)
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 1 {
+		t.Fatal("expected the server to be re-added once the maintenance ended")
+	}
+}
+
+func TestSmoothLatency(t *testing.T) {
+	smoothed := smoothLatency(0, 100*time.Millisecond)
+	if smoothed != 100*time.Millisecond {
+		t.Fatalf("expected the first latency to be kept, got %s", smoothed)
+	}
+	smoothed = smoothLatency(smoothed, 200*time.Millisecond)
+	if smoothed != 130*time.Millisecond {
+		t.Errorf("got %s, expected 130ms", smoothed)
+	}
+}
+
+func TestProbeMaxLatency(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer ts.Close()
+	serverURL := mustParseURL(t, ts.URL)
+
+	cases := []struct {
+		maxLatency time.Duration
+		expected   probeResult
+	}{
+		{maxLatency: 0, expected: probeHealthy},
+		{maxLatency: time.Second, expected: probeHealthy},
+		{maxLatency: 5 * time.Millisecond, expected: probeUnhealthy},
+	}
+	for _, c := range cases {
+		backend := NewBackendHealthCheck(Options{MaxLatency: c.maxLatency})
+		if result := New().probe(context.Background(), "backend", serverURL, backend); result != c.expected {
+			t.Errorf("max latency %s: got result %d, expected %d", c.maxLatency, result, c.expected)
+		}
+		backend.closeIdleConnections()
+	}
+}
+
+func TestHealthPath(t *testing.T) {
+	schemeURLs := map[string]string{"https": "/secure/health"}
+	cases := []struct {
+		serverURL string
+		options   Options
+		expected  string
+	}{
+		{serverURL: "http://10.0.0.1:8080", options: Options{URL: "/health", SchemeURLs: schemeURLs}, expected: "/health"},
+		{serverURL: "https://10.0.0.1:8443", options: Options{URL: "/health", SchemeURLs: schemeURLs}, expected: "/secure/health"},
+		{serverURL: "http://10.0.0.1:8080", options: Options{URL: "/health", Scheme: "https", SchemeURLs: schemeURLs}, expected: "/secure/health"},
+		{serverURL: "https://10.0.0.1:8443", options: Options{URL: "/health"}, expected: "/health"},
+	}
+	for _, c := range cases {
+		if path := healthPath(mustParseURL(t, c.serverURL), NewBackendHealthCheck(c.options)); path != c.expected {
+			t.Errorf("%s: got %s, expected %s", c.serverURL, path, c.expected)
+		}
+	}
+}
+
+func TestCheckHealthMultipleEndpoints(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/live":
+			w.WriteHeader(http.StatusOK)
+		case "/draining":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+	serverURL := mustParseURL(t, ts.URL)
+	drainStatus := StatusCodes{{Min: http.StatusServiceUnavailable, Max: http.StatusServiceUnavailable}}
+
+	cases := []struct {
+		desc     string
+		urls     []string
+		require  string
+		expected probeResult
+	}{
+		{desc: "all healthy", urls: []string{"/live", "/live"}, expected: probeHealthy},
+		{desc: "all with a failure", urls: []string{"/live", "/ready"}, expected: probeUnhealthy},
+		{desc: "all with a drain", urls: []string{"/live", "/draining"}, expected: probeDraining},
+		{desc: "any with a success", urls: []string{"/ready", "/live"}, require: RequireAny, expected: probeHealthy},
+		{desc: "any without success", urls: []string{"/ready", "/ready"}, require: RequireAny, expected: probeUnhealthy},
+		{desc: "any with a drain", urls: []string{"/ready", "/draining"}, require: RequireAny, expected: probeDraining},
+	}
+	for _, c := range cases {
+		backend := NewBackendHealthCheck(Options{URL: c.urls[0], URLs: c.urls[1:], Require: c.require, DrainStatus: drainStatus})
+		if result := checkServer(context.Background(), serverURL, backend).result; result != c.expected {
+			t.Errorf("%s: got result %d, expected %d", c.desc, result, c.expected)
+		}
+		backend.closeIdleConnections()
+	}
+}
+
+func TestCheckHealthProbeFunc(t *testing.T) {
+	healthyURL := mustParseURL(t, "http://127.0.0.1:1")
+	var probed []string
+	backend := NewBackendHealthCheck(Options{
+		ProbeFunc: func(ctx context.Context, serverURL *url.URL) bool {
+			if _, ok := ctx.Deadline(); !ok {
+				t.Error("expected the probe context to have a deadline")
+			}
+			probed = append(probed, serverURL.String())
+			return serverURL == healthyURL
+		},
+	})
+
+	if !checkHealth(context.Background(), healthyURL, backend) {
+		t.Error("expected the server to be healthy")
+	}
+	if checkHealth(context.Background(), mustParseURL(t, "http://127.0.0.1:2"), backend) {
+		t.Error("expected the server to be unhealthy")
+	}
+	expected := []string{"http://127.0.0.1:1", "http://127.0.0.1:2"}
+	if !reflect.DeepEqual(probed, expected) {
+		t.Errorf("got probes %v, expected %v", probed, expected)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		value    string
+		expected time.Time
+	}{
+		{value: "", expected: time.Time{}},
+		{value: "120", expected: now.Add(2 * time.Minute)},
+		{value: "0", expected: time.Time{}},
+		{value: "soon", expected: time.Time{}},
+		{value: "Wed, 01 Mar 2017 12:05:00 GMT", expected: now.Add(5 * time.Minute)},
+		{value: "86400", expected: now.Add(maxRetryAfter)},
+	}
+	for _, c := range cases {
+		if retryAfter := parseRetryAfter(c.value, now); !retryAfter.Equal(c.expected) {
+			t.Errorf("%q: got %s, expected %s", c.value, retryAfter, c.expected)
+		}
+	}
+}
+
+func TestCheckBackendRetryAfter(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	backend := NewBackendHealthCheck(Options{URL: "/health", Interval: time.Minute, LB: lb})
+	defer backend.closeIdleConnections()
+	hc := New()
+
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 0 {
+		t.Fatal("server should have been removed")
+	}
+	hc.checkBackend(context.Background(), "backend", backend)
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("expected the removed server not to be probed before its Retry-After, got %d probes", n)
+	}
+}
+
+func TestCheckBackendWarmupGrace(t *testing.T) {
+	ts := newTestServer(http.StatusInternalServerError)
+	defer ts.Close()
+
+	serverURL := mustParseURL(t, ts.URL)
+	lb := NewFakeLoadBalancer(serverURL)
+	backend := NewBackendHealthCheck(Options{URL: "/health", WarmupGrace: time.Hour, LB: lb})
+	defer backend.closeIdleConnections()
+	hc := New()
+
+	hc.checkBackend(context.Background(), "backend", backend)
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 1 {
+		t.Fatal("expected the failures to be ignored during the warmup grace period")
+	}
+
+	// pretend the server was first seen before the grace period
+	backend.lock.Lock()
+	backend.serverState(serverURL).firstSeen = time.Now().Add(-2 * time.Hour)
+	backend.lock.Unlock()
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 0 {
+		t.Error("expected the server to be removed once the warmup grace period has elapsed")
+	}
+}
+
+func TestCheckBackendDisabledServerReadded(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	serverURL := mustParseURL(t, ts.URL)
+	lb := NewFakeLoadBalancer(serverURL)
+	backend := NewBackendHealthCheck(Options{URL: "/health", LB: lb})
+	defer backend.closeIdleConnections()
+	hc := New()
+	hc.checkBackend(context.Background(), "backend", backend)
+
+	// a racing provider puts the removed server back in the load balancer
+	lb.SetServers(append(lb.Servers(), mustParseURL(t, ts.URL))...)
+	atomic.StoreInt32(&hits, 0)
+	hc.checkBackend(context.Background(), "backend", backend)
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("expected the server to be probed once, got %d probes", n)
+	}
+	if countCalls(lb, false) != 1 {
+		t.Errorf("expected the server to be removed once, got %d removals", countCalls(lb, false))
+	}
+	if status := backend.disabledServers(); len(status) != 1 {
+		t.Errorf("expected the server to be reported once, got %v", status)
+	}
+}
+
+func TestCheckBackendMaxEjectionPercent(t *testing.T) {
+	ts := newTestServer(http.StatusInternalServerError)
+	defer ts.Close()
+
+	var servers []*url.URL
+	for i := 0; i < 4; i++ {
+		// distinct URLs of the same failing server
+		servers = append(servers, mustParseURL(t, ts.URL+"/"+strconv.Itoa(i)))
+	}
+	lb := NewFakeLoadBalancer(servers...)
+	backend := NewBackendHealthCheck(Options{URL: "/health", MaxEjectionPercent: 50, LB: lb})
+	defer backend.closeIdleConnections()
+	hc := New()
+
+	hc.checkBackend(context.Background(), "backend", backend)
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 2 || len(backend.disabledServers()) != 2 {
+		t.Errorf("expected at most half of the servers to be removed, got %d removed and %d in rotation", len(backend.disabledServers()), len(lb.Servers()))
+	}
+}
+
+func TestCheckBackendDrainStatus(t *testing.T) {
+	draining := newTestServer(http.StatusServiceUnavailable)
+	defer draining.Close()
+	failing := newTestServer(http.StatusInternalServerError)
+	defer failing.Close()
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, draining.URL), mustParseURL(t, failing.URL))
+	backend := NewBackendHealthCheck(Options{
+		URL:                "/health",
+		DrainStatus:        StatusCodes{{Min: http.StatusServiceUnavailable, Max: http.StatusServiceUnavailable}},
+		UnhealthyThreshold: 3,
+		LB:                 lb,
+	})
+	defer backend.closeIdleConnections()
+	hc := New()
+	events := make(chan Event, 1)
+	defer hc.Subscribe(func(event Event) { events <- event })()
+
+	if result := checkServer(context.Background(), mustParseURL(t, draining.URL), backend).result; result != probeDraining {
+		t.Fatalf("expected the 503 response to report a draining server, got %d", result)
+	}
+
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 1 || lb.Servers()[0].String() != failing.URL {
+		t.Fatalf("expected only the draining server to be removed right away, got %v", lb.Servers())
+	}
+	select {
+	case event := <-events:
+		if event.Healthy || !event.Draining || event.URL.String() != draining.URL {
+			t.Errorf("expected a draining event for %s, got %+v", draining.URL, event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected an event for the draining server")
+	}
+}
+
+func TestServerless(t *testing.T) {
+	backend := NewBackendHealthCheck(Options{Interval: time.Minute})
+	servers := []*url.URL{mustParseURL(t, "http://127.0.0.1:8080")}
+	start := time.Now()
+
+	cases := []struct {
+		desc     string
+		now      time.Time
+		servers  []*url.URL
+		expected bool
+	}{
+		{desc: "first empty check", now: start, expected: false},
+		{desc: "empty for less than an interval", now: start.Add(30 * time.Second), expected: false},
+		{desc: "empty for an interval", now: start.Add(time.Minute), expected: true},
+		{desc: "still empty", now: start.Add(2 * time.Minute), expected: true},
+		{desc: "servers added", now: start.Add(3 * time.Minute), servers: servers, expected: false},
+		{desc: "empty again", now: start.Add(4 * time.Minute), expected: false},
+	}
+	for _, c := range cases {
+		if serverless := backend.serverless(c.now, c.servers); serverless != c.expected {
+			t.Errorf("%s: got %t, expected %t", c.desc, serverless, c.expected)
+		}
+	}
+}
+
+// entriesHook collects the log entries fired by the standard logger.
+type entriesHook struct {
+	lock    sync.Mutex
+	entries []*logrus.Entry
+}
+
+func (h *entriesHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h *entriesHook) Fire(entry *logrus.Entry) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.entries = append(h.entries, entry)
+	return nil
+}
+
+func TestCheckBackendTransitionLog(t *testing.T) {
+	ts := newTestServer(http.StatusServiceUnavailable)
+	defer ts.Close()
+
+	hook := &entriesHook{}
+	log.AddHook(hook)
+	level := log.GetLevel()
+	log.SetLevel(logrus.DebugLevel)
+	defer log.SetLevel(level)
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	backend := NewBackendHealthCheck(Options{URL: "/health", LB: lb})
+	defer backend.closeIdleConnections()
+	New().checkBackend(context.Background(), "backend", backend)
+
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	for _, entry := range hook.entries {
+		if entry.Data["server"] != ts.URL {
+			continue
+		}
+		expected := logrus.Fields{"backend": "backend", "oldState": stateUp, "newState": stateDown, "statusCode": http.StatusServiceUnavailable}
+		for key, value := range expected {
+			if entry.Data[key] != value {
+				t.Errorf("expected field %s to be %v, got %v", key, value, entry.Data[key])
+			}
+		}
+		if _, ok := entry.Data["latency"]; !ok {
+			t.Error("expected the latency of the probe to be logged")
+		}
+		return
+	}
+	t.Error("expected the removal of the server to be logged with structured fields")
+}
+
+func TestCheckBackendSlowStart(t *testing.T) {
+	var status int32 = http.StatusInternalServerError
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer ts.Close()
+
+	lb := NewFakeLoadBalancer()
+	serverURL := mustParseURL(t, ts.URL)
+	lb.UpsertServer(serverURL, 8)
+	backend := NewBackendHealthCheck(Options{URL: "/health", SlowStart: time.Hour, LB: lb})
+	defer backend.closeIdleConnections()
+	hc := New()
+
+	// rampFrom pretends the server was re-added the given duration ago.
+	rampFrom := func(elapsed time.Duration) {
+		backend.lock.Lock()
+		backend.serverState(serverURL).rampStart = time.Now().Add(-elapsed)
+		backend.lock.Unlock()
+	}
+	assertWeight := func(expected int) {
+		weight, ok := lb.ServerWeight(serverURL)
+		if !ok || weight != expected {
+			t.Fatalf("expected the server to have weight %d, got %d (present: %t)", expected, weight, ok)
+		}
+	}
+
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 0 {
+		t.Fatal("server should have been removed")
+	}
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	hc.checkBackend(context.Background(), "backend", backend)
+	assertWeight(1)
+
+	rampFrom(30 * time.Minute)
+	hc.checkBackend(context.Background(), "backend", backend)
+	assertWeight(4)
+
+	rampFrom(time.Hour)
+	hc.checkBackend(context.Background(), "backend", backend)
+	assertWeight(8)
+	backend.lock.RLock()
+	ramping := !backend.serverState(serverURL).rampStart.IsZero()
+	backend.lock.RUnlock()
+	if ramping {
+		t.Error("expected the ramp to be over once the server reached its weight")
+	}
+}
+
+func TestCheckHealthTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverURL := mustParseURL(t, "tcp://"+listener.Addr().String())
+	backend := NewBackendHealthCheck(Options{Mode: ModeTCP})
+
+	if !checkHealth(context.Background(), serverURL, backend) {
+		t.Error("expected the TCP probe to succeed against a listening server")
+	}
+	listener.Close()
+	if checkHealth(context.Background(), serverURL, backend) {
+		t.Error("expected the TCP probe to fail against a closed server")
+	}
+}
+
+func TestCheckHealthSchemeOverride(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	// the server is registered over HTTP but its health endpoint is served over HTTPS
+	serverURL := mustParseURL(t, strings.Replace(ts.URL, "https://", "http://", 1))
+
+	if checkHealth(context.Background(), serverURL, NewBackendHealthCheck(Options{URL: "/health"})) {
+		t.Error("expected the plain HTTP probe to fail")
+	}
+	if checkHealth(context.Background(), serverURL, NewBackendHealthCheck(Options{URL: "/health", Scheme: "https"})) {
+		t.Error("expected the HTTPS probe to fail on the self-signed certificate")
+	}
+	if !checkHealth(context.Background(), serverURL, NewBackendHealthCheck(Options{URL: "/health", Scheme: "https", InsecureSkipVerify: true})) {
+		t.Error("expected the HTTPS probe to succeed when skipping verification")
+	}
+}
+
+func TestCheckHealthCheckFunc(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `{"status":"degraded"}`)
+	}))
+	defer ts.Close()
+	serverURL := mustParseURL(t, ts.URL)
+
+	cases := []struct {
+		desc     string
+		status   string
+		expected bool
+	}{
+		{desc: "accepted payload", status: "degraded", expected: true},
+		{desc: "rejected payload", status: "up", expected: false},
+	}
+	for _, c := range cases {
+		accepted := c.status
+		backend := NewBackendHealthCheck(Options{URL: "/health", CheckFunc: func(resp *http.Response) bool {
+			var payload struct{ Status string }
+			return json.NewDecoder(resp.Body).Decode(&payload) == nil && payload.Status == accepted
+		}})
+		if healthy := checkHealth(context.Background(), serverURL, backend); healthy != c.expected {
+			t.Errorf("%s: got healthy=%t, expected %t", c.desc, healthy, c.expected)
+		}
+	}
+}
+
+func TestCheckHealthTLSServerName(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ts.Certificate())
+	// the test certificate is valid for example.com but not for the hostname of the server
+	serverURL := mustParseURL(t, strings.Replace(ts.URL, "127.0.0.1", "backend.invalid", 1))
+	hosts := map[string]string{"backend.invalid": "127.0.0.1"}
+
+	if checkHealth(context.Background(), serverURL, NewBackendHealthCheck(Options{URL: "/health", Hosts: hosts, RootCAs: rootCAs})) {
+		t.Error("expected the verification of the server hostname to fail")
+	}
+	backend := NewBackendHealthCheck(Options{URL: "/health", Hosts: hosts, RootCAs: rootCAs, TLSServerName: "example.com"})
+	if !checkHealth(context.Background(), serverURL, backend) {
+		t.Error("expected the certificate to be verified against the TLS server name")
+	}
+}
+
+func TestCheckHealthMinCertValidity(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	serverURL := mustParseURL(t, ts.URL)
+	validity := time.Until(ts.Certificate().NotAfter)
+
+	cases := []struct {
+		minCertValidity time.Duration
+		expected        bool
+	}{
+		{minCertValidity: 0, expected: true},
+		{minCertValidity: validity - 24*time.Hour, expected: true},
+		{minCertValidity: validity + 24*time.Hour, expected: false},
+	}
+	for _, c := range cases {
+		backend := NewBackendHealthCheck(Options{URL: "/health", InsecureSkipVerify: true, MinCertValidity: c.minCertValidity})
+		if healthy := checkHealth(context.Background(), serverURL, backend); healthy != c.expected {
+			t.Errorf("min validity %s: got healthy=%t, expected %t", c.minCertValidity, healthy, c.expected)
+		}
+	}
+}
+
+func TestCheckHealthClientCertificate(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ts.Certificate())
+	serverURL := mustParseURL(t, ts.URL)
+
+	if checkHealth(context.Background(), serverURL, NewBackendHealthCheck(Options{URL: "/health", RootCAs: rootCAs})) {
+		t.Error("expected the probe to fail without a client certificate")
+	}
+	// the server certificate doubles as a client certificate
+	backend := NewBackendHealthCheck(Options{URL: "/health", RootCAs: rootCAs, Certificates: ts.TLS.Certificates})
+	if !checkHealth(context.Background(), serverURL, backend) {
+		t.Error("expected the probe to succeed with a client certificate")
+	}
+}
+
+func TestCheckHealthHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "health.localhost" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	backend := NewBackendHealthCheck(Options{
+		URL: "/health",
+		Headers: map[string]string{
+			"Host":          "health.localhost",
+			"Authorization": "Bearer token",
+		},
+	})
+	if !checkHealth(context.Background(), mustParseURL(t, ts.URL), backend) {
+		t.Error("expected the probe to send the configured headers")
+	}
+}
+
+func TestCheckHealthRetries(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// only the third attempt succeeds
+		if atomic.AddInt32(&hits, 1)%3 != 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		retries  int
+		expected bool
+	}{
+		{retries: 0, expected: false},
+		{retries: 2, expected: true},
+	}
+	for _, c := range cases {
+		atomic.StoreInt32(&hits, 0)
+		backend := NewBackendHealthCheck(Options{URL: "/health", Retries: c.retries})
+		if healthy := checkHealth(context.Background(), mustParseURL(t, ts.URL), backend); healthy != c.expected {
+			t.Errorf("%d retries: got healthy=%t, expected %t", c.retries, healthy, c.expected)
+		}
+		if n := atomic.LoadInt32(&hits); n != int32(c.retries+1) {
+			t.Errorf("%d retries: expected %d probes, got %d", c.retries, c.retries+1, n)
+		}
+	}
+}
+
+func TestCheckHealthSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "healthcheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "admin.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.Listener.Close()
+	ts.Listener = listener
+	ts.Start()
+	defer ts.Close()
+
+	// the server itself is not listening
+	serverURL := mustParseURL(t, "http://127.0.0.1:1")
+	for _, mode := range []string{ModeHTTP, ModeTCP} {
+		backend := NewBackendHealthCheck(Options{Mode: mode, URL: "/health", Socket: socket})
+		if !checkHealth(context.Background(), serverURL, backend) {
+			t.Errorf("%s: expected the probe to go through the socket", mode)
+		}
+	}
+}
+
+func TestCheckHealthHosts(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Host, "backend.invalid:") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	serverURL := mustParseURL(t, strings.Replace(ts.URL, "127.0.0.1", "backend.invalid", 1))
+
+	for _, mode := range []string{ModeHTTP, ModeTCP} {
+		backend := NewBackendHealthCheck(Options{Mode: mode, URL: "/health", Timeout: time.Second})
+		if checkHealth(context.Background(), serverURL, backend) {
+			t.Errorf("%s: expected the probe of an unresolvable host to fail", mode)
+		}
+		backend = NewBackendHealthCheck(Options{Mode: mode, URL: "/health", Hosts: map[string]string{"backend.invalid": "127.0.0.1"}})
+		if !checkHealth(context.Background(), serverURL, backend) {
+			t.Errorf("%s: expected the probe to connect to the overridden host", mode)
+		}
+	}
+}
+
+func TestCheckHealthBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil || string(body) != `{"selfTest":true}` || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	backend := NewBackendHealthCheck(Options{
+		URL:         "/health",
+		Method:      http.MethodPost,
+		Body:        `{"selfTest":true}`,
+		ContentType: "application/json",
+	})
+	// every probe sends the whole body, not only the first one
+	for i := 0; i < 2; i++ {
+		if !checkHealth(context.Background(), mustParseURL(t, ts.URL), backend) {
+			t.Fatalf("probe %d: expected the body to be sent", i)
+		}
+	}
+}
+
+func TestCheckHealthUserAgent(t *testing.T) {
+	userAgents := make(chan []string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents <- r.Header["User-Agent"]
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		desc     string
+		options  Options
+		expected []string
+	}{
+		{desc: "default", options: Options{}, expected: []string{"Traefik-HealthCheck/" + version.Version}},
+		{desc: "custom", options: Options{UserAgent: "probe/1.0"}, expected: []string{"probe/1.0"}},
+		{desc: "cleared", options: Options{Headers: map[string]string{"User-Agent": ""}}, expected: nil},
+	}
+	for _, c := range cases {
+		c.options.URL = "/health"
+		if !checkHealth(context.Background(), mustParseURL(t, ts.URL), NewBackendHealthCheck(c.options)) {
+			t.Fatalf("%s: expected the probe to succeed", c.desc)
+		}
+		if userAgent := <-userAgents; !reflect.DeepEqual(userAgent, c.expected) {
+			t.Errorf("%s: got User-Agent %q, expected %q", c.desc, userAgent, c.expected)
+		}
+	}
+}
+
+func TestCheckHealthAccept(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/json" {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer ts.Close()
+
+	serverURL := mustParseURL(t, ts.URL)
+	backend := NewBackendHealthCheck(Options{URL: "/health"})
+	defer backend.closeIdleConnections()
+	if checkHealth(context.Background(), serverURL, backend) {
+		t.Error("expected the probe without Accept header to be answered with 406")
+	}
+	backend = NewBackendHealthCheck(Options{URL: "/health", Accept: "application/json"})
+	defer backend.closeIdleConnections()
+	if !checkHealth(context.Background(), serverURL, backend) {
+		t.Error("expected the probe accepting JSON to succeed")
+	}
+}
+
+func TestCheckHealthBasicAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "probe" || password != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+
+	serverURL := mustParseURL(t, ts.URL)
+	backend := NewBackendHealthCheck(Options{URL: "/health"})
+	defer backend.closeIdleConnections()
+	if checkHealth(context.Background(), serverURL, backend) {
+		t.Error("expected the probe without credentials to be answered with 401")
+	}
+	options := Options{URL: "/health", Username: "probe", Password: "s3cret"}
+	backend = NewBackendHealthCheck(options)
+	defer backend.closeIdleConnections()
+	if !checkHealth(context.Background(), serverURL, backend) {
+		t.Error("expected the probe with credentials to succeed")
+	}
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		if logged := fmt.Sprintf(format, options); strings.Contains(logged, "s3cret") {
+			t.Errorf("expected the password to be redacted with %s, got %s", format, logged)
+		}
+	}
+}
+
+func TestProbeURLPortOverride(t *testing.T) {
+	serverURL := mustParseURL(t, "http://10.0.0.1:8080")
+
+	cases := []struct {
+		options  Options
+		expected string
+	}{
+		{
+			options:  Options{URL: "/health", Port: 8081, ServerPorts: map[string]int{"http://10.0.0.1:8080": 31002}},
+			expected: "http://10.0.0.1:31002/health",
+		},
+		{
+			options:  Options{URL: "/health", Port: 8081, ServerPorts: map[string]int{"http://10.0.0.2:8080": 31002}},
+			expected: "http://10.0.0.1:8081/health",
+		},
+		{Options{URL: "/health"}, "http://10.0.0.1:8080/health"},
+		{Options{URL: "/health", Port: 8081}, "http://10.0.0.1:8081/health"},
+		{Options{URL: "/health", Port: 8443, Scheme: "https"}, "https://10.0.0.1:8443/health"},
+		{Options{URL: "/health/{host}-{port}"}, "http://10.0.0.1:8080/health/10.0.0.1-8080"},
+		{Options{URL: "/health/{port}", Port: 8081}, "http://10.0.0.1:8081/health/8080"},
+		{Options{URL: "/health?verbose=1"}, "http://10.0.0.1:8080/health?verbose=1"},
+		{Options{URL: "health"}, "http://10.0.0.1:8080/health"},
+	}
+	for _, c := range cases {
+		if u := probeURL(serverURL, NewBackendHealthCheck(c.options), c.options.URL); u != c.expected {
+			t.Errorf("got %s, expected %s", u, c.expected)
+		}
+	}
+	if serverURL.String() != "http://10.0.0.1:8080" {
+		t.Errorf("the server URL must not be modified, got %s", serverURL)
+	}
+}
+
+func TestProbeURLIPv6(t *testing.T) {
+	cases := []struct {
+		serverURL string
+		options   Options
+		expected  string
+	}{
+		{serverURL: "http://[::1]:8080", options: Options{URL: "/health"}, expected: "http://[::1]:8080/health"},
+		{serverURL: "http://[::1]:8080", options: Options{URL: "/health", Port: 8081}, expected: "http://[::1]:8081/health"},
+		{serverURL: "http://[::1]", options: Options{URL: "/health", Port: 8443, Scheme: "https"}, expected: "https://[::1]:8443/health"},
+		{serverURL: "http://[fe80::1%25eth0]:8080", options: Options{URL: "/health", Port: 8081}, expected: "http://[fe80::1%25eth0]:8081/health"},
+		{serverURL: "http://[::1]:8080/app", options: Options{URL: "/health/{port}"}, expected: "http://[::1]:8080/app/health/8080"},
+	}
+	for _, c := range cases {
+		if u := probeURL(mustParseURL(t, c.serverURL), NewBackendHealthCheck(c.options), c.options.URL); u != c.expected {
+			t.Errorf("%s: got %s, expected %s", c.serverURL, u, c.expected)
+		}
+	}
+}
+
+func TestHostPortIPv6(t *testing.T) {
+	cases := []struct {
+		serverURL string
+		expected  string
+	}{
+		{serverURL: "http://[::1]:8080", expected: "[::1]:8080"},
+		{serverURL: "http://[::1]", expected: "[::1]:80"},
+		{serverURL: "https://[2001:db8::1]", expected: "[2001:db8::1]:443"},
+	}
+	for _, c := range cases {
+		if address := hostPort(mustParseURL(t, c.serverURL)); address != c.expected {
+			t.Errorf("%s: got %s, expected %s", c.serverURL, address, c.expected)
+		}
+	}
+}
+
+func TestCheckHealthIPv6(t *testing.T) {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 is not available: %s", err)
+	}
+	ts := &httptest.Server{
+		Listener: listener,
+		Config:   &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})},
+	}
+	ts.Start()
+	defer ts.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	cases := []struct {
+		desc      string
+		serverURL string
+		options   Options
+	}{
+		{desc: "http", serverURL: ts.URL, options: Options{URL: "/health"}},
+		{desc: "tcp", serverURL: ts.URL, options: Options{Mode: ModeTCP}},
+		{desc: "port override", serverURL: "http://[::1]:1", options: Options{URL: "/health", Port: port}},
+	}
+	for _, c := range cases {
+		backend := NewBackendHealthCheck(c.options)
+		if !checkHealth(context.Background(), mustParseURL(t, c.serverURL), backend) {
+			t.Errorf("%s: expected the probe of the IPv6 server to succeed", c.desc)
+		}
+		backend.closeIdleConnections()
+	}
+}
+
+func TestCheckHealthExpectedBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"degraded"}`))
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		desc    string
+		options Options
+		healthy bool
+	}{
+		{"no expectation", Options{}, true},
+		{"matching substring", Options{ExpectedBody: `"status":"degraded"`}, true},
+		{"missing substring", Options{ExpectedBody: `"status":"ok"`}, false},
+		{"matching regexp", Options{ExpectedBodyRegexp: regexp.MustCompile(`"status":\s*"(ok|degraded)"`)}, true},
+		{"non matching regexp", Options{ExpectedBodyRegexp: regexp.MustCompile(`"status":\s*"ok"`)}, false},
+	}
+	serverURL := mustParseURL(t, ts.URL)
+	for _, c := range cases {
+		c.options.URL = "/health"
+		if healthy := checkHealth(context.Background(), serverURL, NewBackendHealthCheck(c.options)); healthy != c.healthy {
+			t.Errorf("%s: got healthy=%t, expected %t", c.desc, healthy, c.healthy)
+		}
+	}
+}
+
+func TestCheckHealthExpectedHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Ready", "true")
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		desc    string
+		headers map[string]string
+		healthy bool
+	}{
+		{"no expectation", nil, true},
+		{"matching header", map[string]string{"x-ready": "true"}, true},
+		{"mismatching value", map[string]string{"X-Ready": "false"}, false},
+		{"missing header", map[string]string{"X-Ready": "true", "X-Version": "2"}, false},
+	}
+	serverURL := mustParseURL(t, ts.URL)
+	for _, c := range cases {
+		backend := NewBackendHealthCheck(Options{URL: "/health", ExpectedHeaders: c.headers})
+		if healthy := checkHealth(context.Background(), serverURL, backend); healthy != c.healthy {
+			t.Errorf("%s: got healthy=%t, expected %t", c.desc, healthy, c.healthy)
+		}
+		backend.closeIdleConnections()
+	}
+}
+
+func TestStatus(t *testing.T) {
+	healthy := newTestServer(http.StatusOK)
+	defer healthy.Close()
+	unhealthy := newTestServer(http.StatusInternalServerError)
+	defer unhealthy.Close()
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, healthy.URL), mustParseURL(t, unhealthy.URL))
+	backend := NewBackendHealthCheck(Options{URL: "/health", Interval: time.Hour, LB: lb})
+	defer backend.closeIdleConnections()
+
+	hc := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hc.SetBackendsConfiguration(ctx, map[string]*BackendHealthCheck{"backend1": backend})
+
+	// the initial check runs as soon as the configuration is set
+	expected := map[string][]string{"backend1": {unhealthy.URL}}
+	deadline := time.Now().Add(time.Second)
+	for !reflect.DeepEqual(hc.Status(), expected) {
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected status %v", hc.Status())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cases := []struct {
+		backendID, serverURL string
+		healthy, checked     bool
+	}{
+		{backendID: "backend1", serverURL: healthy.URL, healthy: true, checked: true},
+		{backendID: "backend1", serverURL: unhealthy.URL, healthy: false, checked: true},
+		{backendID: "backend2", serverURL: healthy.URL, healthy: false, checked: false},
+	}
+	for _, c := range cases {
+		if healthy, checked := hc.ServerHealth(c.backendID, c.serverURL); healthy != c.healthy || checked != c.checked {
+			t.Errorf("%s %s: got healthy=%t checked=%t, expected healthy=%t checked=%t", c.backendID, c.serverURL, healthy, checked, c.healthy, c.checked)
+		}
+	}
+
+	if checked, latency, ok := hc.LastCheck("backend1", healthy.URL); !ok || checked.IsZero() || latency <= 0 {
+		t.Errorf("expected the last check of %s to be recorded, got a probe of %s at %s (ok: %t)", healthy.URL, latency, checked, ok)
+	}
+	if _, _, ok := hc.LastCheck("backend2", healthy.URL); ok {
+		t.Error("expected no last check for a backend which is not checked")
+	}
+}
+
+func TestHealthRatio(t *testing.T) {
+	healthy := newTestServer(http.StatusOK)
+	defer healthy.Close()
+	unhealthy := newTestServer(http.StatusInternalServerError)
+	defer unhealthy.Close()
+
+	lb := NewFakeLoadBalancer()
+	backend := NewBackendHealthCheck(Options{URL: "/health", LB: lb})
+	defer backend.closeIdleConnections()
+	if ratio := backend.HealthRatio(); ratio != 0 {
+		t.Errorf("expected a backend without servers to have a ratio of 0, got %f", ratio)
+	}
+
+	lb.SetServers(mustParseURL(t, healthy.URL), mustParseURL(t, healthy.URL+"/1"), mustParseURL(t, healthy.URL+"/2"), mustParseURL(t, unhealthy.URL))
+	if ratio := backend.HealthRatio(); ratio != 1 {
+		t.Errorf("expected a ratio of 1 before any check, got %f", ratio)
+	}
+	hc := New()
+	hc.checkBackend(context.Background(), "backend", backend)
+	if ratio := backend.HealthRatio(); ratio != 0.75 {
+		t.Errorf("expected a ratio of 0.75, got %f", ratio)
+	}
+	if _, ok := hc.HealthRatio("backend"); ok {
+		t.Error("expected no ratio for a backend which is not configured")
+	}
+}
+
+func TestConcurrentStatusAndChecks(t *testing.T) {
+	var status int32 = http.StatusOK
+	ts := newTestServerFunc(func() int { return int(atomic.LoadInt32(&status)) })
+	defer ts.Close()
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	backend := NewBackendHealthCheck(Options{URL: "/health", Interval: time.Hour, LB: lb})
+	defer backend.closeIdleConnections()
+
+	hc := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hc.SetBackendsConfiguration(ctx, map[string]*BackendHealthCheck{"backend1": backend})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			atomic.StoreInt32(&status, int32(http.StatusOK+i%2*300))
+			hc.checkBackend(context.Background(), "backend1", backend)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			hc.Status()
+			hc.HealthRatio("backend1")
+		}
+	}
+}
+
+func TestCheckBackendCanceled(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	backend := NewBackendHealthCheck(Options{URL: "/health", LB: lb})
+	defer backend.closeIdleConnections()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	New().checkBackend(ctx, "backend1", backend)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the check should have been aborted promptly, took %s", elapsed)
+	}
+	if len(lb.Servers()) != 1 {
+		t.Error("a canceled probe must not remove the server")
+	}
+}
+
+func TestHealthCheckBackendOptions(t *testing.T) {
+	hc := New()
+	hc.Backends = map[string]*BackendHealthCheck{
+		"backend1": NewBackendHealthCheck(Options{URL: "/health", Interval: 10 * time.Second, Headers: map[string]string{"Host": "health.localhost"}}),
+		"backend2": NewBackendHealthCheck(Options{Mode: ModeTCP}),
+	}
+	options := hc.BackendOptions()
+	if len(options) != 2 {
+		t.Fatalf("expected the options of 2 backends, got %d", len(options))
+	}
+	if options["backend1"].URL != "/health" || options["backend1"].Interval != 10*time.Second {
+		t.Errorf("unexpected options of backend1: URL %q and interval %s", options["backend1"].URL, options["backend1"].Interval)
+	}
+	if options["backend2"].Mode != ModeTCP || options["backend2"].Interval != DefaultInterval {
+		t.Errorf("expected the defaults to be applied to backend2, got mode %q and interval %s", options["backend2"].Mode, options["backend2"].Interval)
+	}
+
+	options["backend1"].Headers["Host"] = "other.localhost"
+	if hc.Backends["backend1"].Headers["Host"] != "health.localhost" {
+		t.Error("expected the options to be a snapshot")
+	}
+}
+
+func TestHealthCheckBackendOptionsJSON(t *testing.T) {
+	hc := New()
+	hc.Backends = map[string]*BackendHealthCheck{
+		"backend1": NewBackendHealthCheck(Options{URL: "/health", Username: "admin", Password: "s3cr3t", LB: NewFakeLoadBalancer()}),
+	}
+	data, err := json.Marshal(hc.BackendOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cr3t") {
+		t.Fatalf("expected the password to be redacted, got %s", data)
+	}
+	var decoded map[string]struct{ URL, Username, Password string }
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if backend := decoded["backend1"]; backend.URL != "/health" || backend.Username != "admin" || backend.Password != Redacted {
+		t.Errorf("unexpected encoded options %+v", backend)
+	}
+}
+
+func TestProbeDeepURL(t *testing.T) {
+	var deepStatus int32 = http.StatusOK
+	var deepHits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/deep-health" {
+			atomic.AddInt32(&deepHits, 1)
+			w.WriteHeader(int(atomic.LoadInt32(&deepStatus)))
+		}
+	}))
+	defer ts.Close()
+	serverURL := mustParseURL(t, ts.URL)
+
+	backend := NewBackendHealthCheck(Options{URL: "/health", DeepURL: "/deep-health", DeepInterval: time.Hour})
+	defer backend.closeIdleConnections()
+	hc := New()
+
+	if result := hc.probe(context.Background(), "backend", serverURL, backend); result != probeHealthy {
+		t.Fatalf("expected the server to be healthy, got %d", result)
+	}
+	atomic.StoreInt32(&deepStatus, http.StatusServiceUnavailable)
+	if result := hc.probe(context.Background(), "backend", serverURL, backend); result != probeHealthy {
+		t.Fatalf("expected the last deep result to be kept until the deep interval elapses, got %d", result)
+	}
+	if n := atomic.LoadInt32(&deepHits); n != 1 {
+		t.Fatalf("expected one deep probe per deep interval, got %d", n)
+	}
+
+	backend.DeepInterval = 0
+	if result := hc.probe(context.Background(), "backend", serverURL, backend); result != probeUnhealthy {
+		t.Errorf("expected the failing deep probe to fail the server, got %d", result)
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	cases := []struct {
+		desc    string
+		options Options
+		wantErr bool
+	}{
+		{desc: "defaults", options: Options{}},
+		{desc: "relative URL", options: Options{URL: "/health/{host}?verbose=1"}},
+		{desc: "absolute URL", options: Options{URL: "http://10.0.0.1/health"}, wantErr: true},
+		{desc: "malformed URL", options: Options{URL: "/health%zz"}, wantErr: true},
+		{desc: "malformed additional URL", options: Options{URL: "/live", URLs: []string{"/ready%zz"}}, wantErr: true},
+		{desc: "absolute scheme URL", options: Options{SchemeURLs: map[string]string{"https": "https://host/health"}}, wantErr: true},
+		{desc: "unknown mode", options: Options{Mode: "icmp"}, wantErr: true},
+		{desc: "lowercase method", options: Options{Method: "head"}},
+		{desc: "unknown method", options: Options{Method: "GTE"}, wantErr: true},
+		{desc: "deep URL in tcp mode", options: Options{Mode: ModeTCP, DeepURL: "/deep-health"}, wantErr: true},
+		{desc: "additional URLs in tcp mode", options: Options{Mode: ModeTCP, URLs: []string{"/ready"}}, wantErr: true},
+		{desc: "exec mode without command", options: Options{Mode: ModeExec}, wantErr: true},
+		{desc: "command in http mode", options: Options{Command: []string{"true"}}, wantErr: true},
+		{desc: "negative interval", options: Options{Interval: -time.Second}, wantErr: true},
+		{desc: "negative timeout", options: Options{Timeout: -time.Second}, wantErr: true},
+		{desc: "port out of range", options: Options{Port: 70000}, wantErr: true},
+		{desc: "jitter out of range", options: Options{Jitter: 101}, wantErr: true},
+		{desc: "negative retries", options: Options{Retries: -1}, wantErr: true},
+		{desc: "unknown require rule", options: Options{Require: "most"}, wantErr: true},
+		{desc: "socket in udp mode", options: Options{Mode: ModeUDP, Socket: "/run/health.sock"}, wantErr: true},
+		{desc: "skip initial check and start unhealthy", options: Options{SkipInitialCheck: true, StartUnhealthy: true}, wantErr: true},
+	}
+	for _, c := range cases {
+		if err := c.options.Validate(); (err != nil) != c.wantErr {
+			t.Errorf("%s: got error %v, expected an error: %t", c.desc, err, c.wantErr)
+		}
+	}
+
+	for method, expected := range map[string]string{"": http.MethodGet, "head": http.MethodHead} {
+		options := Options{Method: method}
+		if err := options.Validate(); err != nil || options.Method != expected {
+			t.Errorf("method %q: expected %s, got %q and error %v", method, expected, options.Method, err)
+		}
+	}
+}
+
+func TestSetBackendsConfigurationRejectsInvalidOptions(t *testing.T) {
+	hc := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, "http://10.0.0.1:8080"))
+	hc.SetBackendsConfiguration(ctx, map[string]*BackendHealthCheck{
+		"mode":     NewBackendHealthCheck(Options{Mode: "icmp", Interval: time.Hour, LB: lb}),
+		"interval": NewBackendHealthCheck(Options{URL: "/health", Interval: -time.Second, LB: lb}),
+		"valid":    NewBackendHealthCheck(Options{URL: "/health", Interval: time.Hour, LB: lb}),
+	})
+	for _, backendID := range []string{"mode", "interval"} {
+		if hc.backend(backendID) != nil {
+			t.Errorf("expected the check of backend %s to be rejected", backendID)
+		}
+	}
+	if hc.backend("valid") == nil {
+		t.Error("expected the valid check to be started")
+	}
+}
+
+func TestNewTransportProxy(t *testing.T) {
+	transport := newTransport(NewBackendHealthCheck(Options{})).(*http.Transport)
+	if transport.Proxy != nil {
+		t.Error("expected the probes to connect directly to the servers by default")
+	}
+	transport = newTransport(NewBackendHealthCheck(Options{UseProxy: true})).(*http.Transport)
+	if transport.Proxy == nil {
+		t.Error("expected the probes to use the proxy from the environment")
+	}
+}
+
+func TestNewBackendHealthCheckTimeout(t *testing.T) {
+	if backend := NewBackendHealthCheck(Options{}); backend.requestTimeout != defaultRequestTimeout {
+		t.Errorf("expected the default timeout %s, got %s", defaultRequestTimeout, backend.requestTimeout)
+	}
+
+	backend := NewBackendHealthCheck(Options{Timeout: 50 * time.Millisecond})
+	if backend.requestTimeout != 50*time.Millisecond || backend.client.Timeout != 50*time.Millisecond {
+		t.Errorf("expected the timeout to be 50ms, got %s", backend.requestTimeout)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer ts.Close()
+	if checkHealth(context.Background(), mustParseURL(t, ts.URL), backend) {
+		t.Error("expected a probe slower than the timeout to fail")
+	}
+}
+
+func TestNewBackendHealthCheckDefaults(t *testing.T) {
+	hc := New()
+	hc.SetDefaultOptions(Options{Interval: 10 * time.Second, Timeout: time.Second, UnhealthyThreshold: 3, Method: http.MethodHead})
+
+	backend := hc.NewBackendHealthCheck(Options{URL: "/health", UnhealthyThreshold: 5})
+	if backend.Interval != 10*time.Second || backend.requestTimeout != time.Second || backend.Method != http.MethodHead {
+		t.Errorf("expected the unset options to be inherited, got interval %s, timeout %s and method %q", backend.Interval, backend.requestTimeout, backend.Method)
+	}
+	if backend.URL != "/health" || backend.UnhealthyThreshold != 5 {
+		t.Errorf("expected the set options to be kept, got URL %q and unhealthy threshold %d", backend.URL, backend.UnhealthyThreshold)
+	}
+	if backend.HealthyThreshold != 1 {
+		t.Errorf("expected the healthy threshold to default to 1, got %d", backend.HealthyThreshold)
+	}
+}
+
+func TestNewBackendHealthCheckDefaultsOnlyUnsetFields(t *testing.T) {
+	hc := New()
+	hc.SetDefaultOptions(Options{FailOpen: true, ObserveOnly: true, Retries: 2, Interval: 10 * time.Second})
+
+	backend := hc.NewBackendHealthCheck(Options{URL: "/health", FailOpen: false, Retries: 0})
+	if backend.FailOpen || backend.ObserveOnly || backend.Retries != 0 {
+		t.Errorf("expected the backend to keep its false and zero options, got fail open %t, observe only %t and %d retries", backend.FailOpen, backend.ObserveOnly, backend.Retries)
+	}
+	if backend.Interval != 10*time.Second {
+		t.Errorf("expected the unset interval to be inherited, got %s", backend.Interval)
+	}
+}
+
+func TestNewBackendHealthCheckDefaultsByHealthCheck(t *testing.T) {
+	first, second := New(), New()
+	first.SetDefaultOptions(Options{Interval: 10 * time.Second, UnhealthyThreshold: 3})
+	second.SetDefaultOptions(Options{Interval: time.Minute, Method: http.MethodHead})
+
+	backend := first.NewBackendHealthCheck(Options{URL: "/health"})
+	if backend.Interval != 10*time.Second || backend.UnhealthyThreshold != 3 || backend.Method != "" {
+		t.Errorf("expected the defaults of the first health check, got interval %s, unhealthy threshold %d and method %q", backend.Interval, backend.UnhealthyThreshold, backend.Method)
+	}
+	backend = second.NewBackendHealthCheck(Options{URL: "/health"})
+	if backend.Interval != time.Minute || backend.UnhealthyThreshold != 1 || backend.Method != http.MethodHead {
+		t.Errorf("expected the defaults of the second health check, got interval %s, unhealthy threshold %d and method %q", backend.Interval, backend.UnhealthyThreshold, backend.Method)
+	}
+	backend = NewBackendHealthCheck(Options{URL: "/health"})
+	if backend.Interval != DefaultInterval || backend.UnhealthyThreshold != 1 || backend.Method != "" {
+		t.Errorf("expected no defaults to be inherited, got interval %s, unhealthy threshold %d and method %q", backend.Interval, backend.UnhealthyThreshold, backend.Method)
+	}
+}
+
+func TestSetBackendsConfigurationKeepsState(t *testing.T) {
+	var status int32 = http.StatusInternalServerError
+	ts := newTestServerFunc(func() int { return int(atomic.LoadInt32(&status)) })
+	defer ts.Close()
+	other := newTestServer(http.StatusOK)
+	defer other.Close()
+
+	newBackend := func(servers ...string) (*BackendHealthCheck, *FakeLoadBalancer) {
+		lb := NewFakeLoadBalancer()
+		for _, server := range servers {
+			lb.SetServers(append(lb.Servers(), mustParseURL(t, server))...)
+		}
+		return NewBackendHealthCheck(Options{URL: "/health", Interval: time.Hour, HealthyThreshold: 3, LB: lb}), lb
+	}
+	hc := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backend, _ := newBackend(ts.URL, other.URL)
+	hc.SetBackendsConfiguration(ctx, map[string]*BackendHealthCheck{"backend": backend})
+	deadline := time.Now().Add(time.Second)
+	for len(backend.disabledServers()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the failing server to be removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	atomic.StoreInt32(&status, http.StatusOK)
+	hc.checkBackend(ctx, "backend", backend)
+
+	// the reload rebuilds the load balancer with all the servers
+	reloaded, lb := newBackend(ts.URL, other.URL)
+	hc.SetBackendsConfiguration(ctx, map[string]*BackendHealthCheck{"backend": reloaded})
+	reloaded.lock.RLock()
+	successes := reloaded.serverState(mustParseURL(t, ts.URL)).successes
+	reloaded.lock.RUnlock()
+	if successes < 1 {
+		t.Errorf("expected the recovery progress to be kept, got %d successes", successes)
+	}
+	hc.Stop(context.Background())
+	if servers := lb.Servers(); len(servers) != 1 || servers[0].String() != other.URL {
+		t.Errorf("expected the removed server to stay out of the reloaded load balancer, got %v", servers)
+	}
+}
+
+func TestReloadHoldsOnlyNewServers(t *testing.T) {
+	ts := newTestServer(http.StatusOK)
+	defer ts.Close()
+	other := newTestServer(http.StatusOK)
+	defer other.Close()
+	added := newTestServer(http.StatusOK)
+	defer added.Close()
+
+	options := Options{URL: "/health", StartUnhealthy: true, HealthyThreshold: 2, WarmupGrace: time.Hour}
+	hc := New()
+	options.LB = NewFakeLoadBalancer(mustParseURL(t, ts.URL), mustParseURL(t, other.URL))
+	backend := NewBackendHealthCheck(options)
+	defer backend.closeIdleConnections()
+	for i := 0; i < 5; i++ {
+		hc.checkBackend(context.Background(), "backend", backend)
+		if len(options.LB.Servers()) == 2 {
+			break
+		}
+	}
+	if len(options.LB.Servers()) != 2 {
+		t.Fatalf("expected the servers to be admitted, got %v", options.LB.Servers())
+	}
+	backend.lock.RLock()
+	firstSeen := backend.servers[ts.URL].firstSeen
+	backend.lock.RUnlock()
+
+	// the reload adds a server: only that one is new
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL), mustParseURL(t, other.URL), mustParseURL(t, added.URL))
+	options.LB = lb
+	reloaded := NewBackendHealthCheck(options)
+	defer reloaded.closeIdleConnections()
+	if reloaded.inherit(standardLogger(), backend) {
+		t.Error("expected the servers of the backend to be reported as changed")
+	}
+	hc.checkBackend(context.Background(), "backend", reloaded)
+	servers := make(map[string]bool)
+	for _, u := range lb.Servers() {
+		servers[u.String()] = true
+	}
+	if !servers[ts.URL] || !servers[other.URL] || servers[added.URL] {
+		t.Errorf("expected only the added server to be held out of rotation, got %v", lb.Servers())
+	}
+	reloaded.lock.RLock()
+	reloadedFirstSeen := reloaded.servers[ts.URL].firstSeen
+	reloaded.lock.RUnlock()
+	if !reloadedFirstSeen.Equal(firstSeen) {
+		t.Errorf("expected the warmup of the known servers not to restart, first seen %s then %s", firstSeen, reloadedFirstSeen)
+	}
+
+	// the reload removes a server: the state of the remaining ones is kept
+	options.LB = NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	shrunk := NewBackendHealthCheck(options)
+	defer shrunk.closeIdleConnections()
+	if shrunk.inherit(standardLogger(), reloaded) {
+		t.Error("expected the servers of the backend to be reported as changed")
+	}
+	shrunk.lock.RLock()
+	state, known := shrunk.servers[ts.URL]
+	_, removed := shrunk.servers[other.URL]
+	shrunk.lock.RUnlock()
+	if !known || !state.firstSeen.Equal(firstSeen) || state.successes < 1 {
+		t.Error("expected the state of the remaining server to be kept")
+	}
+	if removed {
+		t.Error("expected the state of the removed server to be dropped")
+	}
+}
+
+func TestSetBackendsConfigurationRestartsChangedBackends(t *testing.T) {
+	var hitsA, hitsB int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/a" {
+			atomic.AddInt32(&hitsA, 1)
+		} else {
+			atomic.AddInt32(&hitsB, 1)
+		}
+	}))
+	defer ts.Close()
+
+	newBackends := func(intervalB time.Duration) map[string]*BackendHealthCheck {
+		return map[string]*BackendHealthCheck{
+			"a": NewBackendHealthCheck(Options{URL: "/a", Interval: time.Hour, LB: NewFakeLoadBalancer(mustParseURL(t, ts.URL))}),
+			"b": NewBackendHealthCheck(Options{URL: "/b", Interval: intervalB, LB: NewFakeLoadBalancer(mustParseURL(t, ts.URL))}),
+		}
+	}
+	waitFor := func(hits *int32, expected int32) {
+		deadline := time.Now().Add(time.Second)
+		for atomic.LoadInt32(hits) < expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d initial checks, got %d", expected, atomic.LoadInt32(hits))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	hc := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer hc.Stop(context.Background())
+
+	hc.SetBackendsConfiguration(ctx, newBackends(time.Hour))
+	waitFor(&hitsA, 1)
+	waitFor(&hitsB, 1)
+
+	// only the interval of backend b changes
+	hc.SetBackendsConfiguration(ctx, newBackends(2*time.Hour))
+	waitFor(&hitsB, 2)
+	time.Sleep(50 * time.Millisecond)
+	if hits := atomic.LoadInt32(&hitsA); hits != 1 {
+		t.Errorf("expected the checks of the unchanged backend to keep running without a new initial check, got %d checks", hits)
+	}
+}
+
+func TestCheckNow(t *testing.T) {
+	var status int32 = http.StatusOK
+	ts := newTestServerFunc(func() int { return int(atomic.LoadInt32(&status)) })
+	defer ts.Close()
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	backend := NewBackendHealthCheck(Options{URL: "/health", Interval: time.Hour, LB: lb})
+	defer backend.closeIdleConnections()
+	hc := New()
+	if err := hc.CheckNow("backend"); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hc.SetBackendsConfiguration(ctx, map[string]*BackendHealthCheck{"backend": backend})
+	atomic.StoreInt32(&status, http.StatusInternalServerError)
+	// the forced checks race with the initial check of the backend goroutine
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := hc.CheckNow("backend"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(lb.Servers()) != 0 || len(backend.disabledServers()) != 1 {
+		t.Errorf("expected the failing server to be removed by the forced check, got %v", lb.Servers())
+	}
+
+	hc.Pause("backend")
+	if err := hc.CheckNow("backend"); err == nil {
+		t.Error("expected an error for a paused backend")
+	}
+}
+
+func TestSweep(t *testing.T) {
+	var status int32 = http.StatusInternalServerError
+	ts := newTestServerFunc(func() int { return int(atomic.LoadInt32(&status)) })
+	defer ts.Close()
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	backend := NewBackendHealthCheck(Options{URL: "/health", Interval: time.Hour, LB: lb})
+	defer backend.closeIdleConnections()
+	paused := NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	pausedBackend := NewBackendHealthCheck(Options{URL: "/health", Interval: time.Hour, LB: paused})
+	defer pausedBackend.closeIdleConnections()
+	hc := New()
+	hc.Backends = map[string]*BackendHealthCheck{"backend": backend, "paused": pausedBackend}
+	hc.Pause("paused")
+
+	hc.Sweep(context.Background())
+	if len(lb.Servers()) != 0 {
+		t.Errorf("expected the failing server to be removed by the sweep, got %v", lb.Servers())
+	}
+	if len(paused.Servers()) != 1 {
+		t.Errorf("expected the servers of a paused backend to be left untouched, got %v", paused.Servers())
+	}
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	hc.Sweep(context.Background())
+	if len(lb.Servers()) != 1 {
+		t.Errorf("expected the recovered server to be put back by the sweep, got %v", lb.Servers())
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	var status int32 = http.StatusOK
+	ts := newTestServerFunc(func() int { return int(atomic.LoadInt32(&status)) })
+	defer ts.Close()
+	failing := newTestServerFunc(func() int { return http.StatusInternalServerError })
+	defer failing.Close()
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL), mustParseURL(t, failing.URL))
+	backend := NewBackendHealthCheck(Options{URL: "/health", Interval: time.Minute, Timeout: time.Second, LB: lb})
+	defer backend.closeIdleConnections()
+	hc := New()
+	hc.Backends = map[string]*BackendHealthCheck{"backend": backend}
+	hc.Pause("other")
+	hc.checkBackend(context.Background(), "backend", backend)
+
+	snapshot := hc.Snapshot()
+	if len(snapshot) != 1 {
+		t.Fatalf("expected the snapshot of a single backend, got %v", snapshot)
+	}
+	backendStatus := snapshot["backend"]
+	if backendStatus.Interval != time.Minute || backendStatus.Timeout != time.Second || backendStatus.Paused {
+		t.Errorf("unexpected timings of the backend: %+v", backendStatus)
+	}
+	if !reflect.DeepEqual(backendStatus.DisabledURLs, []string{failing.URL}) {
+		t.Errorf("expected %s to be disabled, got %v", failing.URL, backendStatus.DisabledURLs)
+	}
+	up, down := backendStatus.Servers[ts.URL], backendStatus.Servers[failing.URL]
+	if !up.Healthy || up.Successes != 1 || up.LastCheck.IsZero() {
+		t.Errorf("unexpected state of the healthy server: %+v", up)
+	}
+	if down.Healthy || down.Failures != 1 || down.FailureRate != 1 {
+		t.Errorf("unexpected state of the failing server: %+v", down)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	backend := NewBackendHealthCheck(Options{URL: "/health", Interval: 20 * time.Millisecond, LB: lb})
+	defer backend.closeIdleConnections()
+	hc := New()
+	hc.Pause("backend")
+	if !hc.Paused("backend") || hc.Paused("other") {
+		t.Fatal("expected only the paused backend to be reported as paused")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hc.SetBackendsConfiguration(ctx, map[string]*BackendHealthCheck{"backend": backend})
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&hits); n != 0 || len(lb.Servers()) != 1 {
+		t.Fatalf("expected a paused backend to be left untouched, got %d probes and %d servers", n, len(lb.Servers()))
+	}
+
+	hc.Resume("backend")
+	deadline := time.Now().Add(time.Second)
+	for len(lb.Servers()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the failing server to be removed once the backend is resumed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStop(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	hc := New()
+	hc.SetBackendsConfiguration(context.Background(), map[string]*BackendHealthCheck{
+		"backend": NewBackendHealthCheck(Options{URL: "/health", Interval: time.Hour, LB: lb}),
+	})
+	<-started
+
+	if err := hc.Stop(context.Background()); err != nil {
+		t.Fatalf("unexpected error stopping the health checks: %s", err)
+	}
+	if hc.cancel != nil {
+		t.Error("expected the health checks to be canceled")
+	}
+}
+
+func TestCheckBackendConcurrentProbes(t *testing.T) {
+	var inFlight, maxInFlight int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		maxConcurrentProbes int
+		maxConcurrentChecks int
+		expected            int32
+	}{
+		{maxConcurrentProbes: 0, expected: 4},
+		{maxConcurrentProbes: 2, expected: 2},
+		{maxConcurrentProbes: 0, maxConcurrentChecks: 1, expected: 1},
+		{maxConcurrentProbes: 1, maxConcurrentChecks: 3, expected: 3},
+	}
+	for _, c := range cases {
+		// distinct paths let a single test server stand for several servers
+		var servers []*url.URL
+		for i := 0; i < 4; i++ {
+			servers = append(servers, mustParseURL(t, ts.URL+"/"+strconv.Itoa(i)))
+		}
+		lb := NewFakeLoadBalancer(servers...)
+		backend := NewBackendHealthCheck(Options{LB: lb, MaxConcurrentChecks: c.maxConcurrentChecks})
+		hc := New()
+		hc.SetMaxConcurrentProbes(c.maxConcurrentProbes)
+		atomic.StoreInt32(&maxInFlight, 0)
+
+		hc.checkBackend(context.Background(), "backend", backend)
+		backend.closeIdleConnections()
+		if max := atomic.LoadInt32(&maxInFlight); max != c.expected {
+			t.Errorf("limits %d and %d: expected %d concurrent probes, got %d", c.maxConcurrentProbes, c.maxConcurrentChecks, c.expected, max)
+		}
+		if len(lb.Servers()) != 4 {
+			t.Errorf("limits %d and %d: expected all the servers to stay in rotation, got %v", c.maxConcurrentProbes, c.maxConcurrentChecks, lb.Servers())
+		}
+	}
+}
+
+func TestProbeDelays(t *testing.T) {
+	if delays := probeDelays(3, NewBackendHealthCheck(Options{Interval: time.Second})); delays != nil {
+		t.Errorf("expected no delays without jitter, got %v", delays)
+	}
+
+	delays := probeDelays(100, NewBackendHealthCheck(Options{Interval: time.Second, Jitter: 20}))
+	if len(delays) != 100 {
+		t.Fatalf("expected 100 delays, got %d", len(delays))
+	}
+	for _, delay := range delays {
+		if delay < 0 || delay >= 200*time.Millisecond {
+			t.Errorf("expected a delay within 20%% of the interval, got %s", delay)
+		}
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{value: "", expected: DefaultInterval},
+		{value: "10s", expected: 10 * time.Second},
+		{value: "ten seconds", wantErr: true},
+		{value: "0s", wantErr: true},
+		{value: "-5s", wantErr: true},
+	}
+	for _, c := range cases {
+		interval, err := ParseInterval(c.value)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%q: unexpected error %v", c.value, err)
+		}
+		if interval != c.expected {
+			t.Errorf("%q: got %s, expected %s", c.value, interval, c.expected)
+		}
+	}
+
+	if backend := NewBackendHealthCheck(Options{}); backend.Interval != DefaultInterval {
+		t.Errorf("expected an unset interval to default to %s, got %s", DefaultInterval, backend.Interval)
+	}
+}
+
+func TestRunZeroInterval(t *testing.T) {
+	ts := newTestServer(http.StatusOK)
+	defer ts.Close()
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	backend := NewBackendHealthCheck(Options{URL: "/health", LB: lb})
+	defer backend.closeIdleConnections()
+	backend.Interval = 0
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	// run panics in the test goroutine if the interval is not guarded
+	New().run(ctx, "backend", backend)
+}
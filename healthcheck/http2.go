@@ -0,0 +1,142 @@
+package healthcheck
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/http2"
+)
+
+// http2Transport sends the probes over HTTP/2, negotiated with ALPN over TLS
+// and with prior knowledge (h2c) over cleartext connections.
+type http2Transport struct {
+	tls *http.Transport
+	h2c *h2cTransport
+}
+
+func newHTTP2Transport(backend *BackendHealthCheck, transport *http.Transport) *http2Transport {
+	transport.ForceAttemptHTTP2 = true
+	return &http2Transport{
+		tls: transport,
+		h2c: &h2cTransport{
+			transport: &http2.Transport{AllowHTTP: true},
+			dial:      backend.dialContext,
+			idle:      make(map[string][]*h2cConn),
+		},
+	}
+}
+
+func (t *http2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.h2c.RoundTrip(req)
+	}
+	return t.tls.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of both transports.
+func (t *http2Transport) CloseIdleConnections() {
+	t.tls.CloseIdleConnections()
+	t.h2c.CloseIdleConnections()
+}
+
+// h2cTransport sends the probes over h2c connections dialed with the context of the probes,
+// so that a canceled probe stops dialing. The connections are kept open for the next probes,
+// each one being used by a single probe at a time.
+type h2cTransport struct {
+	transport *http2.Transport
+	dial      func(ctx context.Context, network, address string) (net.Conn, error)
+
+	lock sync.Mutex
+	// idle holds the connections not used by a probe, by address.
+	idle map[string][]*h2cConn
+}
+
+type h2cConn struct {
+	conn   net.Conn
+	client *http2.ClientConn
+}
+
+func (t *h2cTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	address := req.URL.Host
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "80")
+	}
+	conn, err := t.connection(req.Context(), address)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := conn.client.RoundTrip(req)
+	if err != nil {
+		conn.conn.Close()
+		return nil, err
+	}
+	resp.Body = &h2cBody{ReadCloser: resp.Body, release: func() {
+		t.release(address, conn)
+	}}
+	return resp, nil
+}
+
+// connection returns an idle connection to address, or dials a new one with ctx.
+func (t *h2cTransport) connection(ctx context.Context, address string) (*h2cConn, error) {
+	t.lock.Lock()
+	for conns := t.idle[address]; len(conns) > 0; conns = t.idle[address] {
+		conn := conns[len(conns)-1]
+		t.idle[address] = conns[:len(conns)-1]
+		if conn.client.CanTakeNewRequest() {
+			t.lock.Unlock()
+			return conn, nil
+		}
+		conn.conn.Close()
+	}
+	t.lock.Unlock()
+
+	netConn, err := t.dial(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	client, err := t.transport.NewClientConn(netConn)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return &h2cConn{conn: netConn, client: client}, nil
+}
+
+// release makes a connection available to the next probes once the response is closed.
+func (t *h2cTransport) release(address string, conn *h2cConn) {
+	if !conn.client.CanTakeNewRequest() {
+		conn.conn.Close()
+		return
+	}
+	t.lock.Lock()
+	t.idle[address] = append(t.idle[address], conn)
+	t.lock.Unlock()
+}
+
+// CloseIdleConnections closes the connections not used by a probe.
+func (t *h2cTransport) CloseIdleConnections() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for address, conns := range t.idle {
+		for _, conn := range conns {
+			conn.conn.Close()
+		}
+		delete(t.idle, address)
+	}
+}
+
+// h2cBody releases the connection of a response when it is closed.
+type h2cBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *h2cBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
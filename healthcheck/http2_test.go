@@ -0,0 +1,117 @@
+package healthcheck
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+// http2Only answers the HTTP/2 requests only.
+var http2Only = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 {
+		w.WriteHeader(http.StatusHTTPVersionNotSupported)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestCheckHealthH2C(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go (&http2.Server{}).ServeConn(conn, &http2.ServeConnOpts{Handler: http2Only})
+		}
+	}()
+	serverURL := mustParseURL(t, "http://"+listener.Addr().String())
+
+	backend := NewBackendHealthCheck(Options{URL: "/health", HTTP2: true})
+	defer backend.closeIdleConnections()
+	if !checkHealth(context.Background(), serverURL, backend) {
+		t.Error("expected the probe to use HTTP/2 with prior knowledge")
+	}
+}
+
+func TestCheckHealthH2CDialsWithProbeContext(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	var accepted int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			go (&http2.Server{}).ServeConn(conn, &http2.ServeConnOpts{Handler: http2Only})
+		}
+	}()
+	serverURL := mustParseURL(t, "http://"+listener.Addr().String())
+
+	backend := NewBackendHealthCheck(Options{URL: "/health", HTTP2: true})
+	defer backend.closeIdleConnections()
+	h2c := backend.client.Transport.(*http2Transport).h2c
+	dial := h2c.dial
+	var dialed []context.Context
+	h2c.dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed = append(dialed, ctx)
+		return dial(ctx, network, address)
+	}
+
+	type probeKey struct{}
+	ctx := context.WithValue(context.Background(), probeKey{}, "probe")
+	for i := 0; i < 2; i++ {
+		if !checkHealth(ctx, serverURL, backend) {
+			t.Fatalf("probe %d: expected the server to be healthy", i)
+		}
+	}
+	if len(dialed) != 1 || dialed[0].Value(probeKey{}) != "probe" {
+		t.Fatalf("expected a single dial with the context of the probe, got %d dials", len(dialed))
+	}
+	if n := atomic.LoadInt32(&accepted); n != 1 {
+		t.Errorf("expected the connection to be reused, got %d connections", n)
+	}
+
+	// a canceled probe does not dial
+	backend.closeIdleConnections()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if checkHealth(canceled, serverURL, backend) {
+		t.Error("expected the canceled probe to fail")
+	}
+	if n := atomic.LoadInt32(&accepted); n != 1 {
+		t.Errorf("expected the canceled probe not to connect, got %d connections", n)
+	}
+}
+
+func TestCheckHealthHTTP2OverTLS(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http2Only)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+	serverURL := mustParseURL(t, ts.URL)
+
+	if checkHealth(context.Background(), serverURL, NewBackendHealthCheck(Options{URL: "/health", InsecureSkipVerify: true})) {
+		t.Error("expected the probe to use HTTP/1.1 by default")
+	}
+	backend := NewBackendHealthCheck(Options{URL: "/health", InsecureSkipVerify: true, HTTP2: true})
+	defer backend.closeIdleConnections()
+	if !checkHealth(context.Background(), serverURL, backend) {
+		t.Error("expected the probe to negotiate HTTP/2")
+	}
+}
@@ -0,0 +1,71 @@
+package healthcheck
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/containous/traefik/log"
+)
+
+// healthCheckLogger holds the logger of a HealthCheck, nil for the standard logger.
+type healthCheckLogger struct {
+	lock  sync.RWMutex
+	entry *logrus.Entry
+}
+
+// standardLogger returns the logger of the health checks whose level was not set with SetLogLevel.
+func standardLogger() *logrus.Entry {
+	return log.WithFields(logrus.Fields{})
+}
+
+// logger returns the logger of the health checks, the standard logger unless a dedicated
+// level was set with SetLogLevel.
+func (hc *HealthCheck) logger() *logrus.Entry {
+	hc.log.lock.RLock()
+	defer hc.log.lock.RUnlock()
+	if hc.log.entry == nil {
+		return standardLogger()
+	}
+	return hc.log.entry
+}
+
+// SetLogLevel sets the level of the logs of the health checks independently of the standard
+// logger level. The logs keep the output, formatter and hooks of the standard logger at the
+// time of the call.
+func (hc *HealthCheck) SetLogLevel(level logrus.Level) {
+	standard := logrus.StandardLogger()
+	entry := logrus.NewEntry(&logrus.Logger{
+		Out:       standard.Out,
+		Formatter: standard.Formatter,
+		Hooks:     standard.Hooks,
+		Level:     level,
+	})
+	hc.log.lock.Lock()
+	hc.log.entry = entry
+	hc.log.lock.Unlock()
+}
+
+// backendLogger returns the logger of the health checks carrying the ID of a backend.
+func (hc *HealthCheck) backendLogger(backendID string) *logrus.Entry {
+	return hc.logger().WithField("backend", backendID)
+}
+
+type contextKey int
+
+// loggerKey is the context key of the logger of the probes.
+const loggerKey contextKey = iota
+
+// withLogger returns a context carrying the logger of the probes, such as the logger of the
+// backend whose servers are probed.
+func withLogger(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey, entry)
+}
+
+// contextLogger returns the logger set in ctx, the standard logger if there is none.
+func contextLogger(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(loggerKey).(*logrus.Entry); ok {
+		return entry
+	}
+	return standardLogger()
+}
@@ -0,0 +1,63 @@
+package healthcheck
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/containous/traefik/log"
+)
+
+func TestCheckBackendLogsBackendID(t *testing.T) {
+	ts := newTestServer(http.StatusServiceUnavailable)
+	defer ts.Close()
+
+	hook := &entriesHook{}
+	log.AddHook(hook)
+	level := log.GetLevel()
+	log.SetLevel(logrus.DebugLevel)
+	defer log.SetLevel(level)
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	backend := NewBackendHealthCheck(Options{URL: "/health", Retries: 1, UnhealthyThreshold: 2, LB: lb})
+	defer backend.closeIdleConnections()
+	New().checkBackend(context.Background(), "backend1", backend)
+
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	var messages []string
+	for _, entry := range hook.entries {
+		if strings.Contains(entry.Message, ts.URL) {
+			messages = append(messages, entry.Message)
+			if entry.Data["backend"] != "backend1" {
+				t.Errorf("expected the backend ID in the log %q, got fields %v", entry.Message, entry.Data)
+			}
+		}
+	}
+	if len(messages) != 2 {
+		t.Errorf("expected the retry and failure logs, got %v", messages)
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	level := log.GetLevel()
+	log.SetLevel(logrus.ErrorLevel)
+	defer log.SetLevel(level)
+
+	hook := &entriesHook{}
+	log.AddHook(hook)
+	verbose, quiet := New(), New()
+	verbose.SetLogLevel(logrus.DebugLevel)
+
+	log.Debugf("standard debug log")
+	verbose.logger().Debugf("health check debug log")
+	quiet.logger().Debugf("other health check debug log")
+
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	if len(hook.entries) != 1 || hook.entries[0].Message != "health check debug log" {
+		t.Fatalf("expected only the debug log of the health check with the debug level, got %v", hook.entries)
+	}
+}
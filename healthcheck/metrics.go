@@ -0,0 +1,164 @@
+package healthcheck
+
+import (
+	"github.com/containous/traefik/types"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	serverUpName        = "traefik_backend_server_up"
+	failuresName        = "traefik_healthcheck_failures_total"
+	drainsName          = "traefik_healthcheck_drains_total"
+	latencyName         = "traefik_healthcheck_duration_seconds"
+	smoothedLatencyName = "traefik_healthcheck_smoothed_duration_seconds"
+	failureRateName     = "traefik_healthcheck_failure_rate"
+	serverLabelsName    = "traefik_healthcheck_server_labels"
+)
+
+// Metrics holds the instruments updated by the health checks.
+// A nil *Metrics is valid and records nothing.
+type Metrics struct {
+	// ServerUp is set to 1 when a server is in rotation and to 0 when it has been removed, by backend and server.
+	ServerUp metrics.Gauge
+	// Failures counts the failed probes, by backend, server and reason of the failure, such as timeout or bad_status:500.
+	Failures metrics.Counter
+	// Drains counts the probes reporting a drain status, by backend and server.
+	Drains metrics.Counter
+	// Latency observes the duration of the probes in seconds, by backend.
+	Latency metrics.Histogram
+	// SmoothedLatency is the exponentially weighted moving average of the probe durations in seconds, by backend and server.
+	SmoothedLatency metrics.Gauge
+	// FailureRate is the share of failed probes among the last probes of a server, by backend and server.
+	FailureRate metrics.Gauge
+	// ServerLabels is set to 1 for each metadata label of a server, by backend, server, label name and value,
+	// so that the other metrics can be joined with the metadata of their servers.
+	ServerLabels metrics.Gauge
+}
+
+// NewPrometheusMetrics returns the health check metrics exported to Prometheus, registered
+// with registerer. The collectors already registered with it, by another health check, are
+// shared rather than registered again.
+func NewPrometheusMetrics(config *types.Prometheus, registerer stdprometheus.Registerer) *Metrics {
+	var buckets []float64
+	if config != nil && config.Buckets != nil {
+		buckets = config.Buckets
+	} else {
+		buckets = []float64{0.1, 0.3, 1.2, 5}
+	}
+
+	return &Metrics{
+		ServerUp: prometheus.NewGauge(register(registerer, stdprometheus.NewGaugeVec(
+			stdprometheus.GaugeOpts{
+				Name: serverUpName,
+				Help: "Whether a backend server is in rotation (1) or removed by the health check (0).",
+			},
+			[]string{"backend", "server"},
+		)).(*stdprometheus.GaugeVec)),
+		Failures: prometheus.NewCounter(register(registerer, stdprometheus.NewCounterVec(
+			stdprometheus.CounterOpts{
+				Name: failuresName,
+				Help: "How many health check probes failed, partitioned by backend, server and reason.",
+			},
+			[]string{"backend", "server", "reason"},
+		)).(*stdprometheus.CounterVec)),
+		Drains: prometheus.NewCounter(register(registerer, stdprometheus.NewCounterVec(
+			stdprometheus.CounterOpts{
+				Name: drainsName,
+				Help: "How many health check probes reported a draining server, partitioned by backend and server.",
+			},
+			[]string{"backend", "server"},
+		)).(*stdprometheus.CounterVec)),
+		Latency: prometheus.NewHistogram(register(registerer, stdprometheus.NewHistogramVec(
+			stdprometheus.HistogramOpts{
+				Name:    latencyName,
+				Help:    "How long the health check probes took, partitioned by backend.",
+				Buckets: buckets,
+			},
+			[]string{"backend"},
+		)).(*stdprometheus.HistogramVec)),
+		SmoothedLatency: prometheus.NewGauge(register(registerer, stdprometheus.NewGaugeVec(
+			stdprometheus.GaugeOpts{
+				Name: smoothedLatencyName,
+				Help: "Moving average of the health check probe durations, partitioned by backend and server.",
+			},
+			[]string{"backend", "server"},
+		)).(*stdprometheus.GaugeVec)),
+		FailureRate: prometheus.NewGauge(register(registerer, stdprometheus.NewGaugeVec(
+			stdprometheus.GaugeOpts{
+				Name: failureRateName,
+				Help: "Share of the last health check probes which failed, partitioned by backend and server.",
+			},
+			[]string{"backend", "server"},
+		)).(*stdprometheus.GaugeVec)),
+		ServerLabels: prometheus.NewGauge(register(registerer, stdprometheus.NewGaugeVec(
+			stdprometheus.GaugeOpts{
+				Name: serverLabelsName,
+				Help: "Metadata labels of the health checked servers, partitioned by backend, server, label and value.",
+			},
+			[]string{"backend", "server", "label", "value"},
+		)).(*stdprometheus.GaugeVec)),
+	}
+}
+
+// register registers collector with registerer and returns it, or returns the collector
+// registered before with the same descriptor.
+func register(registerer stdprometheus.Registerer, collector stdprometheus.Collector) stdprometheus.Collector {
+	if err := registerer.Register(collector); err != nil {
+		if registered, ok := err.(stdprometheus.AlreadyRegisteredError); ok {
+			return registered.ExistingCollector
+		}
+		panic(err)
+	}
+	return collector
+}
+
+func (m *Metrics) setServerUp(backendID, server string, up bool) {
+	if m == nil || m.ServerUp == nil {
+		return
+	}
+	value := 0.0
+	if up {
+		value = 1
+	}
+	m.ServerUp.With("backend", backendID, "server", server).Set(value)
+}
+
+func (m *Metrics) setSmoothedLatency(backendID, server string, seconds float64) {
+	if m == nil || m.SmoothedLatency == nil {
+		return
+	}
+	m.SmoothedLatency.With("backend", backendID, "server", server).Set(seconds)
+}
+
+func (m *Metrics) setFailureRate(backendID, server string, rate float64) {
+	if m == nil || m.FailureRate == nil {
+		return
+	}
+	m.FailureRate.With("backend", backendID, "server", server).Set(rate)
+}
+
+func (m *Metrics) setServerLabels(backendID, server string, labels map[string]string) {
+	if m == nil || m.ServerLabels == nil {
+		return
+	}
+	for name, value := range labels {
+		m.ServerLabels.With("backend", backendID, "server", server, "label", name, "value", value).Set(1)
+	}
+}
+
+func (m *Metrics) observeProbe(backendID, server string, seconds float64, outcome probeOutcome) {
+	if m == nil {
+		return
+	}
+	if m.Latency != nil {
+		m.Latency.With("backend", backendID).Observe(seconds)
+	}
+	if outcome.result == probeUnhealthy && m.Failures != nil {
+		m.Failures.With("backend", backendID, "server", server, "reason", outcome.reason).Add(1)
+	}
+	if outcome.result == probeDraining && m.Drains != nil {
+		m.Drains.With("backend", backendID, "server", server).Add(1)
+	}
+}
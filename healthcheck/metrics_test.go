@@ -0,0 +1,53 @@
+package healthcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/containous/traefik/types"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	ts := newTestServer(http.StatusInternalServerError)
+	defer ts.Close()
+
+	registry := stdprometheus.NewRegistry()
+	hc := New()
+	hc.SetMetrics(NewPrometheusMetrics(&types.Prometheus{}, registry))
+	// the health check of another server shares the collectors of the registry
+	other := New()
+	other.SetMetrics(NewPrometheusMetrics(&types.Prometheus{}, registry))
+	lb := NewFakeLoadBalancer(mustParseURL(t, ts.URL))
+	backend := NewBackendHealthCheck(Options{URL: "/health", LB: lb, ServerLabels: map[string]map[string]string{
+		ts.URL: {"zone": "eu-west-1a"},
+	}})
+	defer backend.closeIdleConnections()
+	hc.checkBackend(context.Background(), "backend1", backend)
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(recorder, req)
+	body := recorder.Body.String()
+	for _, name := range []string{serverUpName, failuresName, latencyName, smoothedLatencyName, failureRateName, serverLabelsName} {
+		if !strings.Contains(body, name) {
+			t.Errorf("body does not contain entry '%s'", name)
+		}
+	}
+	if !strings.Contains(body, serverUpName+`{backend="backend1",server="`+ts.URL+`"} 0`) {
+		t.Errorf("expected the server to be reported down, got:\n%s", body)
+	}
+	if !strings.Contains(body, failuresName+`{backend="backend1",reason="bad_status:500",server="`+ts.URL+`"} 1`) {
+		t.Errorf("expected the failure to be reported with its status, got:\n%s", body)
+	}
+	if !strings.Contains(body, serverLabelsName+`{backend="backend1",label="zone",server="`+ts.URL+`",value="eu-west-1a"} 1`) {
+		t.Errorf("expected the zone of the server to be reported, got:\n%s", body)
+	}
+}
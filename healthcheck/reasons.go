@@ -0,0 +1,73 @@
+package healthcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// Reasons of the failed probes, reported by the logs and the failures metric.
+const (
+	reasonTimeout     = "timeout"
+	reasonConnRefused = "conn_refused"
+	reasonDNS         = "dns_error"
+	reasonTLS         = "tls_error"
+	reasonConnection  = "conn_error"
+	reasonRequest     = "bad_request"
+	reasonBadStatus   = "bad_status"
+	reasonHeaders     = "bad_headers"
+	reasonBody        = "bad_body"
+	reasonCertificate = "cert_expiring"
+	reasonSlow        = "slow"
+	// reasonFailed is reported by the probes unable to tell why they failed.
+	reasonFailed = "failed"
+)
+
+// probeOutcome is the result of a probe, along with the reason of its failure if it is unhealthy.
+type probeOutcome struct {
+	result probeResult
+	reason string
+}
+
+// failed returns the outcome of a probe which failed for the given reason.
+func failed(reason string) probeOutcome {
+	return probeOutcome{result: probeUnhealthy, reason: reason}
+}
+
+// outcomeOf converts the outcome of the probes which cannot report a drain.
+func outcomeOf(healthy bool, reason string) probeOutcome {
+	if healthy {
+		return probeOutcome{result: probeHealthy}
+	}
+	return failed(reason)
+}
+
+// classifyError returns the reason of a probe which failed to connect to a server or to get its response.
+func classifyError(err error) string {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return reasonConnRefused
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return reasonTimeout
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return reasonDNS
+	}
+	var (
+		recordErr    tls.RecordHeaderError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	if errors.As(err, &recordErr) || errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr) || strings.Contains(err.Error(), "tls: ") {
+		return reasonTLS
+	}
+	return reasonConnection
+}
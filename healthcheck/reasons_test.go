@@ -0,0 +1,81 @@
+package healthcheck
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckServerFailureReasons(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refusedURL := mustParseURL(t, "http://"+listener.Addr().String())
+	listener.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+	failing := newTestServer(http.StatusInternalServerError)
+	defer failing.Close()
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer secure.Close()
+
+	cases := []struct {
+		desc      string
+		serverURL string
+		options   Options
+		expected  string
+	}{
+		{
+			desc:      "connection refused",
+			serverURL: refusedURL.String(),
+			options:   Options{URL: "/health"},
+			expected:  reasonConnRefused,
+		},
+		{
+			desc:      "connection refused in TCP mode",
+			serverURL: refusedURL.String(),
+			options:   Options{Mode: ModeTCP},
+			expected:  reasonConnRefused,
+		},
+		{
+			desc:      "timeout",
+			serverURL: slow.URL,
+			options:   Options{URL: "/health", Timeout: 50 * time.Millisecond},
+			expected:  reasonTimeout,
+		},
+		{
+			desc:      "bad status",
+			serverURL: failing.URL,
+			options:   Options{URL: "/health"},
+			expected:  "bad_status:500",
+		},
+		{
+			desc:      "unexpected headers",
+			serverURL: slow.URL,
+			options:   Options{URL: "/health", ExpectedHeaders: map[string]string{"X-Ready": "true"}},
+			expected:  reasonHeaders,
+		},
+		{
+			desc:      "untrusted certificate",
+			serverURL: secure.URL,
+			options:   Options{URL: "/health"},
+			expected:  reasonTLS,
+		},
+	}
+
+	for _, c := range cases {
+		backend := NewBackendHealthCheck(c.options)
+		outcome := checkServer(context.Background(), mustParseURL(t, c.serverURL), backend)
+		backend.closeIdleConnections()
+		if outcome.result != probeUnhealthy || outcome.reason != c.expected {
+			t.Errorf("%s: got %+v, expected an unhealthy probe with reason %s", c.desc, outcome, c.expected)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package healthcheck
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// StatusCodes is a set of HTTP status codes considered healthy.
+// An empty set only accepts 200 OK.
+type StatusCodes []StatusRange
+
+// StatusRange is an inclusive range of HTTP status codes.
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+// ParseStatusCodes parses a comma-separated list of status codes and ranges,
+// for example "200,204,302" or "200-399".
+func ParseStatusCodes(value string) (StatusCodes, error) {
+	var codes StatusCodes
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		bounds := strings.SplitN(item, "-", 2)
+		min, err := parseStatusCode(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		max := min
+		if len(bounds) == 2 {
+			max, err = parseStatusCode(bounds[1])
+			if err != nil {
+				return nil, err
+			}
+			if max < min {
+				return nil, fmt.Errorf("invalid status code range %q", item)
+			}
+		}
+		codes = append(codes, StatusRange{Min: min, Max: max})
+	}
+	return codes, nil
+}
+
+func parseStatusCode(value string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || code < 100 || code > 599 {
+		return 0, fmt.Errorf("invalid status code %q", value)
+	}
+	return code, nil
+}
+
+// ParseStatusClasses parses a comma-separated list of status classes and ranges of classes,
+// for example "2xx" or "2xx-3xx".
+func ParseStatusClasses(value string) (StatusCodes, error) {
+	var codes StatusCodes
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		bounds := strings.SplitN(item, "-", 2)
+		min, err := parseStatusClass(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		max := min
+		if len(bounds) == 2 {
+			max, err = parseStatusClass(bounds[1])
+			if err != nil {
+				return nil, err
+			}
+			if max < min {
+				return nil, fmt.Errorf("invalid status class range %q", item)
+			}
+		}
+		codes = append(codes, StatusRange{Min: min * 100, Max: max*100 + 99})
+	}
+	return codes, nil
+}
+
+func parseStatusClass(value string) (int, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if len(value) != 3 || !strings.HasSuffix(value, "xx") || value[0] < '1' || value[0] > '5' {
+		return 0, fmt.Errorf("invalid status class %q", value)
+	}
+	return int(value[0] - '0'), nil
+}
+
+// Contains reports whether the given status code belongs to the set.
+func (codes StatusCodes) Contains(code int) bool {
+	if len(codes) == 0 {
+		return code == http.StatusOK
+	}
+	for _, r := range codes {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+	return false
+}
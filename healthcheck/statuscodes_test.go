@@ -0,0 +1,149 @@
+package healthcheck
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseStatusCodes(t *testing.T) {
+	cases := []struct {
+		desc     string
+		value    string
+		expected StatusCodes
+		wantErr  bool
+	}{
+		{
+			desc:     "empty",
+			value:    "",
+			expected: nil,
+		},
+		{
+			desc:     "single code",
+			value:    "204",
+			expected: StatusCodes{{Min: 204, Max: 204}},
+		},
+		{
+			desc:     "comma-separated list",
+			value:    "200, 204,302",
+			expected: StatusCodes{{Min: 200, Max: 200}, {Min: 204, Max: 204}, {Min: 302, Max: 302}},
+		},
+		{
+			desc:     "range",
+			value:    "200-399",
+			expected: StatusCodes{{Min: 200, Max: 399}},
+		},
+		{
+			desc:    "reversed range",
+			value:   "399-200",
+			wantErr: true,
+		},
+		{
+			desc:    "not a number",
+			value:   "ok",
+			wantErr: true,
+		},
+		{
+			desc:    "out of bounds",
+			value:   "600",
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		codes, err := ParseStatusCodes(c.value)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error for %q", c.desc, c.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.desc, err)
+			continue
+		}
+		if !reflect.DeepEqual(codes, c.expected) {
+			t.Errorf("%s: got %v, expected %v", c.desc, codes, c.expected)
+		}
+	}
+}
+
+func TestParseStatusClasses(t *testing.T) {
+	cases := []struct {
+		desc     string
+		value    string
+		expected StatusCodes
+		wantErr  bool
+	}{
+		{
+			desc:     "empty",
+			value:    "",
+			expected: nil,
+		},
+		{
+			desc:     "single class",
+			value:    "2xx",
+			expected: StatusCodes{{Min: 200, Max: 299}},
+		},
+		{
+			desc:     "range of classes",
+			value:    "2XX-3xx",
+			expected: StatusCodes{{Min: 200, Max: 399}},
+		},
+		{
+			desc:     "comma-separated list",
+			value:    "2xx, 4xx",
+			expected: StatusCodes{{Min: 200, Max: 299}, {Min: 400, Max: 499}},
+		},
+		{
+			desc:    "reversed range",
+			value:   "3xx-2xx",
+			wantErr: true,
+		},
+		{
+			desc:    "status code",
+			value:   "200",
+			wantErr: true,
+		},
+		{
+			desc:    "out of bounds",
+			value:   "6xx",
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		codes, err := ParseStatusClasses(c.value)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error for %q", c.desc, c.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.desc, err)
+			continue
+		}
+		if !reflect.DeepEqual(codes, c.expected) {
+			t.Errorf("%s: got %v, expected %v", c.desc, codes, c.expected)
+		}
+	}
+}
+
+func TestStatusCodesContains(t *testing.T) {
+	var defaults StatusCodes
+	if !defaults.Contains(200) || defaults.Contains(204) {
+		t.Error("an empty set should only accept 200")
+	}
+
+	codes := StatusCodes{{Min: 200, Max: 299}, {Min: 302, Max: 302}}
+	for _, code := range []int{200, 204, 299, 302} {
+		if !codes.Contains(code) {
+			t.Errorf("expected %d to be accepted", code)
+		}
+	}
+	for _, code := range []int{301, 304, 500} {
+		if codes.Contains(code) {
+			t.Errorf("expected %d to be rejected", code)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package healthcheck
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+)
+
+// Store persists the health state of the servers across restarts.
+type Store interface {
+	// Load returns the URLs of the servers removed by the health check, by backend ID.
+	Load() (map[string][]string, error)
+	// Save persists the URLs of the servers removed by the health check, by backend ID.
+	Save(disabled map[string][]string) error
+}
+
+// FileStore is a Store keeping the health state as JSON in a file.
+type FileStore struct {
+	Path string
+}
+
+// NewFileStore returns a Store keeping the health state in the file at path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+// Load reads the health state from the file, it is empty if the file does not exist yet.
+func (s *FileStore) Load() (map[string][]string, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var disabled map[string][]string
+	if err := json.Unmarshal(data, &disabled); err != nil {
+		return nil, err
+	}
+	return disabled, nil
+}
+
+// Save writes the health state to a temporary file renamed over the file,
+// so that a crash never leaves a truncated state behind.
+func (s *FileStore) Save(disabled map[string][]string) error {
+	data, err := json.Marshal(disabled)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// persistence restores the servers removed before a restart and saves the servers currently removed.
+type persistence struct {
+	lock  sync.Mutex
+	store Store
+	// restored holds, by backend ID, the servers removed before the restart which were not seen yet.
+	restored map[string]map[string]bool
+	// saved is the last state saved, to save the state only when it changes.
+	saved map[string][]string
+}
+
+// SetStore makes the health check persist the servers it removes to store, and restores
+// the servers removed before the restart: they are held out of rotation until they pass the check.
+func (hc *HealthCheck) SetStore(store Store) {
+	disabled, err := store.Load()
+	if err != nil {
+		hc.logger().Errorf("Error restoring the health state: %s", err)
+	}
+	restored := make(map[string]map[string]bool, len(disabled))
+	for backendID, servers := range disabled {
+		restored[backendID] = make(map[string]bool, len(servers))
+		for _, server := range servers {
+			restored[backendID][server] = true
+		}
+	}
+	hc.persistence.lock.Lock()
+	hc.persistence.store, hc.persistence.restored, hc.persistence.saved = store, restored, disabled
+	hc.persistence.lock.Unlock()
+}
+
+// takeRestored returns whether a server was removed before the restart, once.
+func (hc *HealthCheck) takeRestored(backendID, serverURL string) bool {
+	hc.persistence.lock.Lock()
+	defer hc.persistence.lock.Unlock()
+	if !hc.persistence.restored[backendID][serverURL] {
+		return false
+	}
+	delete(hc.persistence.restored[backendID], serverURL)
+	return true
+}
+
+// holdRestored removes from the load balancer the servers removed before the restart,
+// so that they are checked as new servers held out of rotation, and returns the other servers.
+func (hc *HealthCheck) holdRestored(backendID string, backend *BackendHealthCheck, urls []*url.URL) []*url.URL {
+	var kept []*url.URL
+	for _, url := range urls {
+		if !hc.takeRestored(backendID, url.String()) {
+			kept = append(kept, url)
+			continue
+		}
+		hc.backendLogger(backendID).Debugf("HealthCheck is holding [%s] out of rotation: server was removed before the restart", url.String())
+		weight := serverWeight(backend.LB, url)
+		backend.removeServer(hc.backendLogger(backendID), url)
+		backend.lock.Lock()
+		state := backend.serverState(url)
+		state.weight, state.held = weight, true
+		backend.disabledURLs.add(url)
+		backend.lock.Unlock()
+		hc.getMetrics().setServerUp(backendID, url.String(), false)
+	}
+	return kept
+}
+
+// saveState saves the servers currently removed if they changed since the last save.
+func (hc *HealthCheck) saveState() {
+	hc.persistence.lock.Lock()
+	defer hc.persistence.lock.Unlock()
+	if hc.persistence.store == nil {
+		return
+	}
+	disabled := hc.Status()
+	for backendID, servers := range disabled {
+		if len(servers) == 0 {
+			delete(disabled, backendID)
+		}
+	}
+	if reflect.DeepEqual(disabled, hc.persistence.saved) {
+		return
+	}
+	if err := hc.persistence.store.Save(disabled); err != nil {
+		hc.logger().Errorf("Error saving the health state: %s", err)
+		return
+	}
+	hc.persistence.saved = disabled
+}
@@ -0,0 +1,75 @@
+package healthcheck
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "healthcheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewFileStore(filepath.Join(dir, "state.json"))
+
+	disabled, err := store.Load()
+	if err != nil || disabled != nil {
+		t.Fatalf("expected an empty state before the first save, got %v, %v", disabled, err)
+	}
+	expected := map[string][]string{"backend": {"http://10.0.0.1:80"}}
+	if err := store.Save(expected); err != nil {
+		t.Fatal(err)
+	}
+	disabled, err = store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(disabled, expected) {
+		t.Errorf("expected %v, got %v", expected, disabled)
+	}
+}
+
+func TestSetStoreRestoresDisabledServers(t *testing.T) {
+	healthy := newTestServer(http.StatusOK)
+	defer healthy.Close()
+	other := newTestServer(http.StatusOK)
+	defer other.Close()
+
+	dir, err := ioutil.TempDir("", "healthcheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewFileStore(filepath.Join(dir, "state.json"))
+	if err := store.Save(map[string][]string{"backend": {healthy.URL}}); err != nil {
+		t.Fatal(err)
+	}
+
+	lb := NewFakeLoadBalancer(mustParseURL(t, healthy.URL), mustParseURL(t, other.URL))
+	backend := NewBackendHealthCheck(Options{URL: "/health", LB: lb, HealthyThreshold: 2})
+	defer backend.closeIdleConnections()
+	hc := New()
+	hc.SetStore(store)
+
+	hc.checkBackend(context.Background(), "backend", backend)
+	if servers := lb.Servers(); len(servers) != 1 || servers[0].String() != other.URL {
+		t.Fatalf("expected the server removed before the restart to be held out of rotation, got %v", servers)
+	}
+	hc.checkBackend(context.Background(), "backend", backend)
+	if len(lb.Servers()) != 2 {
+		t.Fatalf("expected the restored server to be put back once it passed the check, got %v", lb.Servers())
+	}
+	disabled, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(disabled) != 0 {
+		t.Errorf("expected the recovery to be saved, got %v", disabled)
+	}
+}
@@ -0,0 +1,33 @@
+package healthcheck
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+)
+
+// checkUDP considers a server healthy if it answers the probe payload within the timeout,
+// with a response matching the expected body if one is configured.
+func checkUDP(ctx context.Context, serverURL *url.URL, backend *BackendHealthCheck) bool {
+	ctx, cancel := context.WithTimeout(ctx, backend.requestTimeout)
+	defer cancel()
+
+	conn, err := backend.dialContext(ctx, "udp", hostPort(probeTarget(serverURL, backend)))
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte(backend.Payload)); err != nil {
+		return false
+	}
+	response := make([]byte, maxBodySize)
+	n, err := conn.Read(response)
+	if err != nil {
+		return false
+	}
+	return matchBody(bytes.NewReader(response[:n]), backend)
+}
@@ -0,0 +1,58 @@
+package healthcheck
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestUDPServer(t *testing.T, response func(payload []byte) []byte) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buffer := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			if reply := response(buffer[:n]); reply != nil {
+				conn.WriteTo(reply, addr)
+			}
+		}
+	}()
+	return conn
+}
+
+func TestCheckHealthUDP(t *testing.T) {
+	echo := newTestUDPServer(t, func(payload []byte) []byte {
+		if string(payload) == "ping" {
+			return []byte("pong")
+		}
+		return nil
+	})
+	defer echo.Close()
+	serverURL := mustParseURL(t, "http://"+echo.LocalAddr().String())
+
+	cases := []struct {
+		desc     string
+		options  Options
+		expected bool
+	}{
+		{desc: "any response", options: Options{Payload: "ping"}, expected: true},
+		{desc: "matching response", options: Options{Payload: "ping", ExpectedBody: "pong"}, expected: true},
+		{desc: "unexpected response", options: Options{Payload: "ping", ExpectedBody: "ready"}, expected: false},
+		{desc: "no response", options: Options{Payload: "hello"}, expected: false},
+	}
+	for _, c := range cases {
+		c.options.Mode = ModeUDP
+		c.options.Timeout = 100 * time.Millisecond
+		backend := NewBackendHealthCheck(c.options)
+		if healthy := checkHealth(context.Background(), serverURL, backend); healthy != c.expected {
+			t.Errorf("%s: got healthy=%t, expected %t", c.desc, healthy, c.expected)
+		}
+	}
+}
@@ -89,3 +89,97 @@ func (s *HealchCheckSuite) TestSimpleConfiguration(c *check.C) {
 	c.Assert(err, checker.IsNil)
 	c.Assert(resp.StatusCode, checker.Equals, 404)
 }
+
+func (s *HealchCheckSuite) TestRecovery(c *check.C) {
+	whoami1Host := s.composeProject.Container(c, "whoami1").NetworkSettings.IPAddress
+	whoami2Host := s.composeProject.Container(c, "whoami2").NetworkSettings.IPAddress
+
+	file := s.adaptFile(c, "fixtures/healthcheck/simple.toml", struct {
+		Server1 string
+		Server2 string
+	}{whoami1Host, whoami2Host})
+	defer os.Remove(file)
+	cmd := exec.Command(traefikBinary, "--configFile="+file)
+
+	err := cmd.Start()
+	c.Assert(err, checker.IsNil)
+	defer cmd.Process.Kill()
+
+	// wait for traefik
+	err = utils.TryRequest("http://127.0.0.1:8080/api/providers", 60*time.Second, func(res *http.Response) error {
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(string(body), "Host:test.localhost") {
+			return errors.New("Incorrect traefik config: " + string(body))
+		}
+		return nil
+	})
+	c.Assert(err, checker.IsNil)
+
+	setHealth := func(status string) {
+		resp, err := http.Post("http://"+whoami1Host+"/health", "text/plain", bytes.NewBuffer([]byte(status)))
+		c.Assert(err, checker.IsNil)
+		resp.Body.Close()
+	}
+	setHealth("200")
+	defer setHealth("200")
+
+	resp, err := http.Get("http://" + whoami1Host)
+	c.Assert(err, checker.IsNil)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Assert(err, checker.IsNil)
+	whoami1Hostname := hostnameLine(string(body))
+	c.Assert(whoami1Hostname, checker.Not(checker.Equals), "")
+
+	req, err := http.NewRequest("GET", "http://127.0.0.1:8000/", nil)
+	c.Assert(err, checker.IsNil)
+	req.Host = "test.localhost"
+	// servedByWhoami1 reports whether any of a few requests is served by whoami1.
+	servedByWhoami1 := func() (bool, error) {
+		for i := 0; i < 10; i++ {
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return false, err
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return false, err
+			}
+			if hostnameLine(string(body)) == whoami1Hostname {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	setHealth("500")
+	err = utils.Try(15*time.Second, func() error {
+		served, err := servedByWhoami1()
+		if err != nil {
+			return err
+		}
+		if served {
+			return errors.New("request served by the failing server " + whoami1Hostname)
+		}
+		return nil
+	})
+	c.Assert(err, checker.IsNil)
+
+	// the recovered server must be re-added and receive requests again
+	setHealth("200")
+	err = utils.Try(15*time.Second, func() error {
+		served, err := servedByWhoami1()
+		if err != nil {
+			return err
+		}
+		if !served {
+			return errors.New("no request served by the recovered server " + whoami1Hostname)
+		}
+		return nil
+	})
+	c.Assert(err, checker.IsNil)
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os/exec"
+	"strings"
 	"time"
 
+	"github.com/containous/traefik/integration/utils"
+	"github.com/gambol99/go-marathon"
 	"github.com/go-check/check"
 
 	checker "github.com/vdemeester/shakers"
@@ -44,3 +51,103 @@ func (s *MarathonSuite) TestSimpleConfiguration(c *check.C) {
 	c.Assert(err, checker.IsNil)
 	c.Assert(resp.StatusCode, checker.Equals, 404)
 }
+
+func (s *MarathonSuite) TestHealthCheckEjectsDeadTask(c *check.C) {
+	config := marathon.NewDefaultConfig()
+	config.URL = "http://127.0.0.1:8080"
+	client, err := marathon.NewClient(config)
+	c.Assert(err, checker.IsNil)
+
+	// wait for marathon
+	err = utils.Try(60*time.Second, func() error {
+		_, err := client.Ping()
+		return err
+	})
+	c.Assert(err, checker.IsNil)
+
+	app := marathon.NewDockerApplication().
+		Name("/whoami").
+		CPU(0.1).
+		Memory(32).
+		Count(2).
+		AddLabel("traefik.frontend.rule", "Host:whoami.marathon.localhost").
+		AddLabel("traefik.backend.healthcheck.path", "/health").
+		AddLabel("traefik.backend.healthcheck.interval", "1s")
+	app.Container.Docker.Container("emilevauge/whoami").Bridged().Expose(80)
+	_, err = client.CreateApplication(app)
+	c.Assert(err, checker.IsNil)
+	defer client.DeleteApplication(app.ID)
+	err = client.WaitOnApplication(app.ID, 120*time.Second)
+	c.Assert(err, checker.IsNil)
+
+	cmd := exec.Command(traefikBinary, "--configFile=fixtures/marathon/simple.toml")
+	err = cmd.Start()
+	c.Assert(err, checker.IsNil)
+	defer cmd.Process.Kill()
+
+	httpClient := &http.Client{}
+	req, err := http.NewRequest("GET", "http://127.0.0.1:8000/", nil)
+	c.Assert(err, checker.IsNil)
+	req.Host = "whoami.marathon.localhost"
+
+	// wait for traefik
+	err = utils.Try(60*time.Second, func() error {
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+		return nil
+	})
+	c.Assert(err, checker.IsNil)
+
+	tasks, err := client.Tasks(app.ID)
+	c.Assert(err, checker.IsNil)
+	c.Assert(tasks.Tasks, checker.HasLen, 2)
+	deadTask := fmt.Sprintf("http://%s:%d", tasks.Tasks[0].Host, tasks.Tasks[0].Ports[0])
+
+	resp, err := http.Get(deadTask)
+	c.Assert(err, checker.IsNil)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Assert(err, checker.IsNil)
+	deadHostname := hostnameLine(string(body))
+	c.Assert(deadHostname, checker.Not(checker.Equals), "")
+
+	resp, err = http.Post(deadTask+"/health", "text/plain", bytes.NewBuffer([]byte("500")))
+	c.Assert(err, checker.IsNil)
+	resp.Body.Close()
+
+	// the dead task must stop receiving requests within a few health check intervals
+	err = utils.Try(15*time.Second, func() error {
+		for i := 0; i < 10; i++ {
+			resp, err := httpClient.Do(req)
+			if err != nil {
+				return err
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return err
+			}
+			if hostnameLine(string(body)) == deadHostname {
+				return errors.New("request served by the dead task " + deadHostname)
+			}
+		}
+		return nil
+	})
+	c.Assert(err, checker.IsNil)
+}
+
+// hostnameLine returns the Hostname line of a whoami response.
+func hostnameLine(body string) string {
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "Hostname:") {
+			return line
+		}
+	}
+	return ""
+}
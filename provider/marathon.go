@@ -2,6 +2,7 @@ package provider
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"net"
 	"net/http"
@@ -23,6 +24,10 @@ import (
 
 var _ Provider = (*Marathon)(nil)
 
+// marathonEventIDs are the events reloading the configuration: the application events, and the
+// end of the deployments, which turns off the fail-open health checks of the rolled out applications.
+const marathonEventIDs = marathon.EventIDApplications | marathon.EventIDDeploymentSuccess | marathon.EventIDDeploymentFailed
+
 // Marathon holds configuration of the Marathon provider.
 type Marathon struct {
 	BaseProvider
@@ -32,6 +37,8 @@ type Marathon struct {
 	GroupsAsSubDomains      bool           `description:"Convert Marathon groups to subdomains"`
 	DCOSToken               string         `description:"DCOSToken for DCOS environment, This will override the Authorization header"`
 	MarathonLBCompatibility bool           `description:"Add compatibility with marathon-lb labels"`
+	HealthyTasksOnly        bool           `description:"Only expose the tasks reported alive by all their Marathon health checks"`
+	HealthCheckFromEnv      bool           `description:"Read the health check settings missing from the labels from the TRAEFIK_HEALTHCHECK_* environment variables of the apps"`
 	TLS                     *ClientTLS     `description:"Enable Docker TLS support"`
 	DialerTimeout           flaeg.Duration `description:"Set a non-default connection timeout for Marathon"`
 	KeepAlive               flaeg.Duration `description:"Set a non-default TCP Keep Alive time in seconds"`
@@ -86,7 +93,7 @@ func (provider *Marathon) Provide(configurationChan chan<- types.ConfigMessage,
 		provider.marathonClient = client
 
 		if provider.Watch {
-			update, err := client.AddEventsListener(marathon.EventIDApplications)
+			update, err := client.AddEventsListener(marathonEventIDs)
 			if err != nil {
 				log.Errorf("Failed to register for events, %s", err)
 				return err
@@ -130,25 +137,33 @@ func (provider *Marathon) Provide(configurationChan chan<- types.ConfigMessage,
 
 func (provider *Marathon) loadMarathonConfig() *types.Configuration {
 	var MarathonFuncMap = template.FuncMap{
-		"getBackend":                  provider.getBackend,
-		"getBackendServer":            provider.getBackendServer,
-		"getPort":                     provider.getPort,
-		"getWeight":                   provider.getWeight,
-		"getDomain":                   provider.getDomain,
-		"getProtocol":                 provider.getProtocol,
-		"getPassHostHeader":           provider.getPassHostHeader,
-		"getPriority":                 provider.getPriority,
-		"getEntryPoints":              provider.getEntryPoints,
-		"getFrontendRule":             provider.getFrontendRule,
-		"getFrontendBackend":          provider.getFrontendBackend,
-		"hasCircuitBreakerLabels":     provider.hasCircuitBreakerLabels,
-		"hasLoadBalancerLabels":       provider.hasLoadBalancerLabels,
-		"hasMaxConnLabels":            provider.hasMaxConnLabels,
-		"getMaxConnExtractorFunc":     provider.getMaxConnExtractorFunc,
-		"getMaxConnAmount":            provider.getMaxConnAmount,
-		"getLoadBalancerMethod":       provider.getLoadBalancerMethod,
-		"getCircuitBreakerExpression": provider.getCircuitBreakerExpression,
-		"getSticky":                   provider.getSticky,
+		"getBackend":                       provider.getBackend,
+		"getBackendServer":                 provider.getBackendServer,
+		"getPort":                          provider.getPort,
+		"getWeight":                        provider.getWeight,
+		"getDomain":                        provider.getDomain,
+		"getProtocol":                      provider.getProtocol,
+		"getPassHostHeader":                provider.getPassHostHeader,
+		"getPriority":                      provider.getPriority,
+		"getEntryPoints":                   provider.getEntryPoints,
+		"getFrontendRule":                  provider.getFrontendRule,
+		"getFrontendBackend":               provider.getFrontendBackend,
+		"hasCircuitBreakerLabels":          provider.hasCircuitBreakerLabels,
+		"hasLoadBalancerLabels":            provider.hasLoadBalancerLabels,
+		"hasMaxConnLabels":                 provider.hasMaxConnLabels,
+		"getMaxConnExtractorFunc":          provider.getMaxConnExtractorFunc,
+		"getMaxConnAmount":                 provider.getMaxConnAmount,
+		"getLoadBalancerMethod":            provider.getLoadBalancerMethod,
+		"getCircuitBreakerExpression":      provider.getCircuitBreakerExpression,
+		"getSticky":                        provider.getSticky,
+		"hasHealthCheckLabels":             provider.hasHealthCheckLabels,
+		"getHealthCheckPath":               provider.getHealthCheckPath,
+		"getHealthCheckInterval":           provider.getHealthCheckInterval,
+		"getHealthCheckUnhealthyThreshold": provider.getHealthCheckUnhealthyThreshold,
+		"getHealthCheckHealthyThreshold":   provider.getHealthCheckHealthyThreshold,
+		"getHealthCheckPort":               provider.getHealthCheckPort,
+		"getServerHealthCheckPort":         provider.getServerHealthCheckPort,
+		"isDeploying":                      provider.isDeploying,
 	}
 
 	applications, err := provider.marathonClient.Applications(nil)
@@ -244,6 +259,10 @@ func (provider *Marathon) taskFilter(task marathon.Task, applications *marathon.
 
 	//filter healthchecks
 	if application.HasHealthChecks() {
+		if provider.HealthyTasksOnly && !task.HasHealthCheckResults() {
+			log.Debugf("Filtering marathon task %s without healthcheck result", task.AppID)
+			return false
+		}
 		if task.HasHealthCheckResults() {
 			for _, healthcheck := range task.HealthCheckResults {
 				// found one bad healthcheck, return false
@@ -479,6 +498,132 @@ func (provider *Marathon) getCircuitBreakerExpression(application marathon.Appli
 	return "NetworkErrorRatio() > 1"
 }
 
+// getHealthCheckSetting returns the health check setting of an application from its
+// traefik.backend.healthcheck.<name> label, or, if HealthCheckFromEnv is set and the label is missing,
+// from its TRAEFIK_HEALTHCHECK_<NAME> environment variable. The names are lowercase, like the
+// other traefik.backend labels.
+func (provider *Marathon) getHealthCheckSetting(application marathon.Application, name string) (string, bool) {
+	if label, err := provider.getLabel(application, "traefik.backend.healthcheck."+name); err == nil {
+		return label, true
+	}
+	if provider.HealthCheckFromEnv && application.Env != nil {
+		if value, ok := (*application.Env)["TRAEFIK_HEALTHCHECK_"+strings.ToUpper(name)]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// hasHealthCheckLabels reports whether the application sets a valid health check. An invalid
+// health check is logged and skipped, the application being served without it.
+func (provider *Marathon) hasHealthCheckLabels(application marathon.Application) bool {
+	if _, ok := provider.getHealthCheckSetting(application, "path"); !ok {
+		return false
+	}
+	if err := provider.validateHealthCheck(application); err != nil {
+		log.Errorf("Skipping the health check of marathon application %s: %s", application.ID, err)
+		return false
+	}
+	return true
+}
+
+// validateHealthCheck reports the first health check setting of the application which cannot be parsed.
+func (provider *Marathon) validateHealthCheck(application marathon.Application) error {
+	for _, name := range []string{"unhealthythreshold", "healthythreshold"} {
+		if setting, ok := provider.getHealthCheckSetting(application, name); ok {
+			if i, errConv := strconv.Atoi(setting); errConv != nil || i < 1 {
+				return fmt.Errorf("invalid health check %s %q", name, setting)
+			}
+		}
+	}
+	if setting, ok := provider.getHealthCheckSetting(application, "port"); ok {
+		if _, errConv := strconv.Atoi(setting); errConv != nil {
+			return fmt.Errorf("invalid health check port %q", setting)
+		}
+	}
+	return nil
+}
+
+func (provider *Marathon) getHealthCheckPath(application marathon.Application) string {
+	if setting, ok := provider.getHealthCheckSetting(application, "path"); ok {
+		return setting
+	}
+	return ""
+}
+
+func (provider *Marathon) getHealthCheckInterval(application marathon.Application) string {
+	if setting, ok := provider.getHealthCheckSetting(application, "interval"); ok {
+		return setting
+	}
+	return "30s"
+}
+
+func (provider *Marathon) getHealthCheckUnhealthyThreshold(application marathon.Application) int {
+	return provider.getHealthCheckThreshold(application, "unhealthythreshold")
+}
+
+func (provider *Marathon) getHealthCheckHealthyThreshold(application marathon.Application) int {
+	return provider.getHealthCheckThreshold(application, "healthythreshold")
+}
+
+func (provider *Marathon) getHealthCheckThreshold(application marathon.Application, name string) int {
+	if setting, ok := provider.getHealthCheckSetting(application, name); ok {
+		i, errConv := strconv.Atoi(setting)
+		if errConv != nil || i < 1 {
+			log.Errorf("Unable to parse health check %s %s", name, setting)
+			return 1
+		}
+		return i
+	}
+	return 1
+}
+
+// isDeploying reports whether a deployment of the application is in progress. During a rolling
+// deployment, the health check keeps the last server of the backend in rotation until a new task
+// passes, so that the backend is never left without any server.
+func (provider *Marathon) isDeploying(application marathon.Application) bool {
+	return len(application.Deployments) > 0
+}
+
+// getHealthCheckPort returns the port probed by the health check, 0 to probe the server port.
+// A port index is resolved for each task by getServerHealthCheckPort, as the tasks may have different host ports.
+func (provider *Marathon) getHealthCheckPort(application marathon.Application) int {
+	if setting, ok := provider.getHealthCheckSetting(application, "port"); ok {
+		port, errConv := strconv.Atoi(setting)
+		if errConv != nil {
+			log.Errorf("Unable to parse health check port %s", setting)
+			return 0
+		}
+		return port
+	}
+	return 0
+}
+
+// getServerHealthCheckPort returns the port of a task probed by the health check when its application
+// sets a health check port index, 0 to use the port of the backend.
+func (provider *Marathon) getServerHealthCheckPort(task marathon.Task, applications []marathon.Application) int {
+	application, err := getApplication(task, applications)
+	if err != nil {
+		log.Errorf("Unable to get marathon application from task %s", task.AppID)
+		return 0
+	}
+	label, ok := provider.getHealthCheckSetting(application, "portindex")
+	if !ok {
+		return 0
+	}
+	index, errConv := strconv.Atoi(label)
+	if errConv != nil {
+		log.Errorf("Unable to parse health check port index %s", label)
+		return 0
+	}
+	ports := processPorts(application, task)
+	if index < 0 || index > len(ports)-1 {
+		log.Errorf("Unexpected value for health check port index %s on task %s", label, task.ID)
+		return 0
+	}
+	return ports[index]
+}
+
 func processPorts(application marathon.Application, task marathon.Task) []int {
 
 	// Using default port configuration
@@ -333,6 +333,197 @@ func TestMarathonLoadConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			applications: &marathon.Applications{
+				Apps: []marathon.Application{
+					{
+						ID:    "/testHealthCheck",
+						Ports: []int{80},
+						Labels: &map[string]string{
+							"traefik.backend.healthcheck.path":               "/health",
+							"traefik.backend.healthcheck.interval":           "5s",
+							"traefik.backend.healthcheck.unhealthythreshold": "3",
+						},
+					},
+				},
+			},
+			tasks: &marathon.Tasks{
+				Tasks: []marathon.Task{
+					{
+						ID:    "testHealthCheck",
+						AppID: "/testHealthCheck",
+						Host:  "localhost",
+						Ports: []int{80},
+						IPAddresses: []*marathon.IPAddress{
+							{
+								IPAddress: "127.0.0.1",
+								Protocol:  "tcp",
+							},
+						},
+					},
+				},
+			},
+			expectedFrontends: map[string]*types.Frontend{
+				`frontend-testHealthCheck`: {
+					Backend:        "backend-testHealthCheck",
+					PassHostHeader: true,
+					EntryPoints:    []string{},
+					Routes: map[string]types.Route{
+						`route-host-testHealthCheck`: {
+							Rule: "Host:testHealthCheck.docker.localhost",
+						},
+					},
+				},
+			},
+			expectedBackends: map[string]*types.Backend{
+				"backend-testHealthCheck": {
+					Servers: map[string]types.Server{
+						"server-testHealthCheck": {
+							URL:    "http://127.0.0.1:80",
+							Weight: 0,
+						},
+					},
+					HealthCheck: &types.HealthCheck{
+						URL:                "/health",
+						Interval:           "5s",
+						UnhealthyThreshold: 3,
+						HealthyThreshold:   1,
+					},
+				},
+			},
+		},
+		{
+			applications: &marathon.Applications{
+				Apps: []marathon.Application{
+					{
+						ID:          "/testHealthCheckDeploying",
+						Ports:       []int{80},
+						Deployments: []map[string]string{{"id": "97c136bf-5a28-4821-9d94-480d9fbb01c8"}},
+						Labels: &map[string]string{
+							"traefik.backend.healthcheck.path": "/health",
+						},
+					},
+				},
+			},
+			tasks: &marathon.Tasks{
+				Tasks: []marathon.Task{
+					{
+						ID:    "testHealthCheckDeploying",
+						AppID: "/testHealthCheckDeploying",
+						Host:  "localhost",
+						Ports: []int{80},
+						IPAddresses: []*marathon.IPAddress{
+							{
+								IPAddress: "127.0.0.1",
+								Protocol:  "tcp",
+							},
+						},
+					},
+				},
+			},
+			expectedFrontends: map[string]*types.Frontend{
+				`frontend-testHealthCheckDeploying`: {
+					Backend:        "backend-testHealthCheckDeploying",
+					PassHostHeader: true,
+					EntryPoints:    []string{},
+					Routes: map[string]types.Route{
+						`route-host-testHealthCheckDeploying`: {
+							Rule: "Host:testHealthCheckDeploying.docker.localhost",
+						},
+					},
+				},
+			},
+			expectedBackends: map[string]*types.Backend{
+				"backend-testHealthCheckDeploying": {
+					Servers: map[string]types.Server{
+						"server-testHealthCheckDeploying": {
+							URL:    "http://127.0.0.1:80",
+							Weight: 0,
+						},
+					},
+					HealthCheck: &types.HealthCheck{
+						URL:                "/health",
+						Interval:           "30s",
+						UnhealthyThreshold: 1,
+						HealthyThreshold:   1,
+						FailOpen:           true,
+					},
+				},
+			},
+		},
+		{
+			applications: &marathon.Applications{
+				Apps: []marathon.Application{
+					{
+						ID: "/testHealthCheckPortIndex",
+						Labels: &map[string]string{
+							"traefik.backend.healthcheck.path":      "/health",
+							"traefik.backend.healthcheck.portindex": "1",
+						},
+					},
+				},
+			},
+			tasks: &marathon.Tasks{
+				Tasks: []marathon.Task{
+					{
+						ID:    "task1",
+						AppID: "/testHealthCheckPortIndex",
+						Host:  "localhost",
+						Ports: []int{31000, 31001},
+						IPAddresses: []*marathon.IPAddress{
+							{
+								IPAddress: "127.0.0.1",
+								Protocol:  "tcp",
+							},
+						},
+					},
+					{
+						ID:    "task2",
+						AppID: "/testHealthCheckPortIndex",
+						Host:  "localhost",
+						Ports: []int{31500, 31501},
+						IPAddresses: []*marathon.IPAddress{
+							{
+								IPAddress: "127.0.0.1",
+								Protocol:  "tcp",
+							},
+						},
+					},
+				},
+			},
+			expectedFrontends: map[string]*types.Frontend{
+				`frontend-testHealthCheckPortIndex`: {
+					Backend:        "backend-testHealthCheckPortIndex",
+					PassHostHeader: true,
+					EntryPoints:    []string{},
+					Routes: map[string]types.Route{
+						`route-host-testHealthCheckPortIndex`: {
+							Rule: "Host:testHealthCheckPortIndex.docker.localhost",
+						},
+					},
+				},
+			},
+			expectedBackends: map[string]*types.Backend{
+				"backend-testHealthCheckPortIndex": {
+					Servers: map[string]types.Server{
+						"server-task1": {
+							URL:             "http://127.0.0.1:31000",
+							HealthCheckPort: 31001,
+						},
+						"server-task2": {
+							URL:             "http://127.0.0.1:31500",
+							HealthCheckPort: 31501,
+						},
+					},
+					HealthCheck: &types.HealthCheck{
+						URL:                "/health",
+						Interval:           "30s",
+						UnhealthyThreshold: 1,
+						HealthyThreshold:   1,
+					},
+				},
+			},
+		},
 	}
 
 	for _, c := range cases {
@@ -773,6 +964,65 @@ func TestMarathonTaskFilter(t *testing.T) {
 	}
 }
 
+func TestMarathonTaskFilterHealthyTasksOnly(t *testing.T) {
+	applications := &marathon.Applications{
+		Apps: []marathon.Application{
+			{
+				ID:     "foo",
+				Ports:  []int{80},
+				Labels: &map[string]string{},
+				HealthChecks: &[]marathon.HealthCheck{
+					*marathon.NewDefaultHealthCheck(),
+				},
+			},
+		},
+	}
+	cases := []struct {
+		task     marathon.Task
+		expected bool
+	}{
+		{
+			task: marathon.Task{
+				AppID: "foo",
+				Ports: []int{80},
+			},
+			expected: false,
+		},
+		{
+			task: marathon.Task{
+				AppID: "foo",
+				Ports: []int{80},
+				HealthCheckResults: []*marathon.HealthCheckResult{
+					{
+						Alive: true,
+					},
+				},
+			},
+			expected: true,
+		},
+		{
+			task: marathon.Task{
+				AppID: "foo",
+				Ports: []int{80},
+				HealthCheckResults: []*marathon.HealthCheckResult{
+					{
+						Alive: false,
+					},
+				},
+			},
+			expected: false,
+		},
+	}
+
+	provider := &Marathon{HealthyTasksOnly: true}
+	for i, c := range cases {
+		actual := provider.taskFilter(c.task, applications, true)
+		if actual != c.expected {
+			t.Fatalf("case %d: expected %v, got %v", i, c.expected, actual)
+		}
+	}
+}
+
 func TestMarathonAppConstraints(t *testing.T) {
 	cases := []struct {
 		application             marathon.Application
@@ -1385,6 +1635,148 @@ func TestMarathonGetBackend(t *testing.T) {
 	}
 }
 
+func TestMarathonHasHealthCheckLabels(t *testing.T) {
+	provider := &Marathon{}
+	cases := []struct {
+		labels   map[string]string
+		expected bool
+	}{
+		{labels: map[string]string{}, expected: false},
+		{labels: map[string]string{"traefik.backend.healthcheck.path": "/health"}, expected: true},
+		{labels: map[string]string{"traefik.backend.healthcheck.path": "/health", "traefik.backend.healthcheck.unhealthythreshold": "3"}, expected: true},
+		{labels: map[string]string{"traefik.backend.healthcheck.path": "/health", "traefik.backend.healthcheck.unhealthythreshold": "three"}, expected: false},
+		{labels: map[string]string{"traefik.backend.healthcheck.path": "/health", "traefik.backend.healthcheck.healthythreshold": "0"}, expected: false},
+		{labels: map[string]string{"traefik.backend.healthcheck.path": "/health", "traefik.backend.healthcheck.port": "http"}, expected: false},
+	}
+	for _, c := range cases {
+		application := marathon.Application{ID: "/app", Labels: &c.labels}
+		if actual := provider.hasHealthCheckLabels(application); actual != c.expected {
+			t.Errorf("labels %v: expected %t, got %t", c.labels, c.expected, actual)
+		}
+	}
+}
+
+func TestMarathonGetHealthCheckPort(t *testing.T) {
+	provider := &Marathon{}
+
+	cases := []struct {
+		labels   map[string]string
+		expected int
+	}{
+		{
+			labels:   map[string]string{},
+			expected: 0,
+		},
+		{
+			labels: map[string]string{
+				"traefik.backend.healthcheck.port": "8081",
+			},
+			expected: 8081,
+		},
+		{
+			labels: map[string]string{
+				"traefik.backend.healthcheck.portindex": "1",
+			},
+			expected: 0,
+		},
+	}
+
+	for _, c := range cases {
+		application := marathon.Application{ID: "/app", Labels: &c.labels}
+		actual := provider.getHealthCheckPort(application)
+		if actual != c.expected {
+			t.Fatalf("labels %v: expected %d, got %d", c.labels, c.expected, actual)
+		}
+	}
+}
+
+func TestMarathonGetServerHealthCheckPort(t *testing.T) {
+	provider := &Marathon{}
+	tasks := []marathon.Task{
+		{
+			ID:    "task1",
+			AppID: "/app",
+			Ports: []int{31000, 31001},
+		},
+		{
+			ID:    "task2",
+			AppID: "/app",
+			Ports: []int{31500, 31501},
+		},
+	}
+
+	cases := []struct {
+		labels   map[string]string
+		expected []int
+	}{
+		{
+			labels:   map[string]string{},
+			expected: []int{0, 0},
+		},
+		{
+			labels: map[string]string{
+				"traefik.backend.healthcheck.portindex": "1",
+			},
+			expected: []int{31001, 31501},
+		},
+		{
+			labels: map[string]string{
+				"traefik.backend.healthcheck.portindex": "2",
+			},
+			expected: []int{0, 0},
+		},
+	}
+
+	for _, c := range cases {
+		applications := []marathon.Application{{ID: "/app", Labels: &c.labels}}
+		for i, task := range tasks {
+			if actual := provider.getServerHealthCheckPort(task, applications); actual != c.expected[i] {
+				t.Errorf("labels %v, task %s: expected %d, got %d", c.labels, task.ID, c.expected[i], actual)
+			}
+		}
+	}
+}
+
+func TestMarathonGetHealthCheckFromEnv(t *testing.T) {
+	labels := map[string]string{
+		"traefik.backend.healthcheck.interval": "5s",
+	}
+	env := map[string]string{
+		"TRAEFIK_HEALTHCHECK_PATH":               "/health",
+		"TRAEFIK_HEALTHCHECK_INTERVAL":           "10s",
+		"TRAEFIK_HEALTHCHECK_UNHEALTHYTHRESHOLD": "3",
+		"TRAEFIK_HEALTHCHECK_PORT":               "8081",
+		"TRAEFIK_HEALTHCHECK_PORTINDEX":          "1",
+	}
+	application := marathon.Application{ID: "/app", Labels: &labels, Env: &env}
+
+	provider := &Marathon{}
+	if provider.hasHealthCheckLabels(application) {
+		t.Error("expected the environment to be ignored unless healthCheckFromEnv is set")
+	}
+
+	provider = &Marathon{HealthCheckFromEnv: true}
+	if !provider.hasHealthCheckLabels(application) || provider.getHealthCheckPath(application) != "/health" {
+		t.Errorf("expected the path to be read from the environment, got %q", provider.getHealthCheckPath(application))
+	}
+	if interval := provider.getHealthCheckInterval(application); interval != "5s" {
+		t.Errorf("expected the label to take precedence over the environment, got interval %q", interval)
+	}
+	if threshold := provider.getHealthCheckUnhealthyThreshold(application); threshold != 3 {
+		t.Errorf("expected unhealthy threshold 3, got %d", threshold)
+	}
+	if threshold := provider.getHealthCheckHealthyThreshold(application); threshold != 1 {
+		t.Errorf("expected the default healthy threshold, got %d", threshold)
+	}
+	if port := provider.getHealthCheckPort(application); port != 8081 {
+		t.Errorf("expected port 8081, got %d", port)
+	}
+	task := marathon.Task{ID: "task", AppID: "/app", Ports: []int{31000, 31001}}
+	if port := provider.getServerHealthCheckPort(task, []marathon.Application{application}); port != 31001 {
+		t.Errorf("expected the port index to be read from the environment, got port %d", port)
+	}
+}
+
 func TestMarathonGetSubDomain(t *testing.T) {
 	providerGroups := &Marathon{GroupsAsSubDomains: true}
 	providerNoGroups := &Marathon{GroupsAsSubDomains: false}
@@ -9,7 +9,9 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -17,10 +19,12 @@ import (
 	"reflect"
 	"regexp"
 	"sort"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/negroni"
 	"github.com/containous/mux"
 	"github.com/containous/traefik/cluster"
@@ -30,6 +34,7 @@ import (
 	"github.com/containous/traefik/provider"
 	"github.com/containous/traefik/safe"
 	"github.com/containous/traefik/types"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
 	"github.com/streamrail/concurrent-map"
 	"github.com/vulcand/oxy/cbreaker"
 	"github.com/vulcand/oxy/connlimit"
@@ -53,6 +58,7 @@ type Server struct {
 	loggerMiddleware           *middlewares.Logger
 	routinesPool               *safe.Pool
 	leadership                 *cluster.Leadership
+	healthCheck                *healthcheck.HealthCheck
 }
 
 type serverEntryPoints map[string]*serverEntryPoint
@@ -84,6 +90,32 @@ func NewServer(globalConfiguration GlobalConfiguration) *Server {
 	server.globalConfiguration = globalConfiguration
 	server.loggerMiddleware = middlewares.NewLogger(globalConfiguration.AccessLogsFile)
 	server.routinesPool = safe.NewPool(context.Background())
+	server.healthCheck = healthcheck.New()
+	if globalConfiguration.Web != nil && globalConfiguration.Web.Metrics != nil && globalConfiguration.Web.Metrics.Prometheus != nil {
+		server.healthCheck.SetMetrics(healthcheck.NewPrometheusMetrics(globalConfiguration.Web.Metrics.Prometheus, stdprometheus.DefaultRegisterer))
+	}
+	if globalConfiguration.HealthCheck != nil {
+		server.healthCheck.SetMaxConcurrentProbes(globalConfiguration.HealthCheck.MaxConcurrentProbes)
+		server.healthCheck.SetMaxInFlightProbes(globalConfiguration.HealthCheck.MaxInFlightProbes)
+		server.healthCheck.SetAllowedCommands(globalConfiguration.HealthCheck.AllowedCommands)
+		server.healthCheck.SetDefaultOptions(healthcheck.Options{
+			Interval:           time.Duration(globalConfiguration.HealthCheck.Interval),
+			Timeout:            time.Duration(globalConfiguration.HealthCheck.Timeout),
+			UnhealthyThreshold: globalConfiguration.HealthCheck.UnhealthyThreshold,
+			HealthyThreshold:   globalConfiguration.HealthCheck.HealthyThreshold,
+		})
+		if globalConfiguration.HealthCheck.StateFile != "" {
+			server.healthCheck.SetStore(healthcheck.NewFileStore(globalConfiguration.HealthCheck.StateFile))
+		}
+		if globalConfiguration.HealthCheck.LogLevel != "" {
+			level, err := logrus.ParseLevel(strings.ToLower(globalConfiguration.HealthCheck.LogLevel))
+			if err != nil {
+				log.Errorf("Invalid healthcheck log level %q: %s", globalConfiguration.HealthCheck.LogLevel, err)
+			} else {
+				server.healthCheck.SetLogLevel(level)
+			}
+		}
+	}
 	if globalConfiguration.Cluster != nil {
 		// leadership creation if cluster mode
 		server.leadership = cluster.NewLeadership(server.routinesPool.Ctx(), globalConfiguration.Cluster)
@@ -112,6 +144,12 @@ func (server *Server) Wait() {
 	<-server.stopChan
 }
 
+// HealthCheck returns the health checks of the backends of the server, owned by the server
+// rather than shared with the other servers of the process.
+func (server *Server) HealthCheck() *healthcheck.HealthCheck {
+	return server.healthCheck
+}
+
 // Stop stops the server
 func (server *Server) Stop() {
 	defer log.Info("Server stopped")
@@ -147,6 +185,9 @@ func (server *Server) Close() {
 			os.Exit(1)
 		}
 	}(ctx)
+	if err := server.healthCheck.Stop(ctx); err != nil {
+		log.Warnf("Error stopping health checks: %v", err)
+	}
 	server.stopLeadership()
 	server.routinesPool.Cleanup()
 	close(server.configurationChan)
@@ -223,7 +264,7 @@ func (server *Server) listenProviders(stop chan bool) {
 			}
 			server.defaultConfigurationValues(configMsg.Configuration)
 			currentConfigurations := server.currentConfigurations.Get().(configs)
-			jsonConf, _ := json.Marshal(configMsg.Configuration)
+			jsonConf, _ := json.Marshal(configMsg.Configuration.Redacted())
 			log.Debugf("Configuration received from provider %s: %s", configMsg.ProviderName, string(jsonConf))
 			if configMsg.Configuration == nil || configMsg.Configuration.Backends == nil && configMsg.Configuration.Frontends == nil {
 				log.Infof("Skipping empty Configuration for provider %s", configMsg.ProviderName)
@@ -658,16 +699,15 @@ func (server *Server) loadConfig(configurations configs, globalConfiguration Glo
 									log.Errorf("Skipping frontend %s...", frontendName)
 									continue frontend
 								}
-								if configuration.Backends[frontend.Backend].HealthCheck != nil {
-									var interval time.Duration
-									if configuration.Backends[frontend.Backend].HealthCheck.Interval != "" {
-										interval, err = time.ParseDuration(configuration.Backends[frontend.Backend].HealthCheck.Interval)
-										if err != nil {
-											log.Errorf("Wrong healthcheck interval: %s", err)
-											interval = time.Second * 30
-										}
-									}
-									backendsHealthcheck[frontend.Backend] = healthcheck.NewBackendHealthCheck(configuration.Backends[frontend.Backend].HealthCheck.URL, interval, rebalancer)
+							}
+							if configuration.Backends[frontend.Backend].HealthCheck != nil {
+								hcOptions, err := parseHealthCheckOptions(&healthCheckLoadBalancer{lb: rebalancer}, configuration.Backends[frontend.Backend].HealthCheck)
+								if err != nil {
+									log.Errorf("Error parsing healthcheck for backend %s, skipping its health check: %v", frontend.Backend, err)
+								} else {
+									hcOptions.DesiredWeight = configuredWeight(configuration.Backends[frontend.Backend].Servers)
+									hcOptions.ServerPorts = healthCheckPorts(configuration.Backends[frontend.Backend].Servers)
+									backendsHealthcheck[frontend.Backend] = server.healthCheck.NewBackendHealthCheck(*hcOptions)
 								}
 							}
 						case types.Wrr:
@@ -693,15 +733,14 @@ func (server *Server) loadConfig(configurations configs, globalConfiguration Glo
 								}
 							}
 							if configuration.Backends[frontend.Backend].HealthCheck != nil {
-								var interval time.Duration
-								if configuration.Backends[frontend.Backend].HealthCheck.Interval != "" {
-									interval, err = time.ParseDuration(configuration.Backends[frontend.Backend].HealthCheck.Interval)
-									if err != nil {
-										log.Errorf("Wrong healthcheck interval: %s", err)
-										interval = time.Second * 30
-									}
+								hcOptions, err := parseHealthCheckOptions(&healthCheckLoadBalancer{lb: rr}, configuration.Backends[frontend.Backend].HealthCheck)
+								if err != nil {
+									log.Errorf("Error parsing healthcheck for backend %s, skipping its health check: %v", frontend.Backend, err)
+								} else {
+									hcOptions.DesiredWeight = configuredWeight(configuration.Backends[frontend.Backend].Servers)
+									hcOptions.ServerPorts = healthCheckPorts(configuration.Backends[frontend.Backend].Servers)
+									backendsHealthcheck[frontend.Backend] = server.healthCheck.NewBackendHealthCheck(*hcOptions)
 								}
-								backendsHealthcheck[frontend.Backend] = healthcheck.NewBackendHealthCheck(configuration.Backends[frontend.Backend].HealthCheck.URL, interval, rr)
 							}
 						}
 						maxConns := configuration.Backends[frontend.Backend].MaxConn
@@ -765,7 +804,7 @@ func (server *Server) loadConfig(configurations configs, globalConfiguration Glo
 			}
 		}
 	}
-	healthcheck.GetHealthCheck().SetBackendsConfiguration(server.routinesPool.Ctx(), backendsHealthcheck)
+	server.healthCheck.SetBackendsConfiguration(server.routinesPool.Ctx(), backendsHealthcheck)
 	middlewares.SetBackend2FrontendMap(&backend2FrontendMap)
 	//sort routes
 	for _, serverEntryPoint := range serverEntryPoints {
@@ -774,6 +813,307 @@ func (server *Server) loadConfig(configurations configs, globalConfiguration Glo
 	return serverEntryPoints, nil
 }
 
+// oxyLoadBalancer is the part of the oxy load balancers managed by the health checks.
+type oxyLoadBalancer interface {
+	RemoveServer(u *url.URL) error
+	UpsertServer(u *url.URL, options ...roundrobin.ServerOption) error
+	Servers() []*url.URL
+}
+
+// healthCheckLoadBalancer adapts an oxy load balancer to healthcheck.LoadBalancer.
+type healthCheckLoadBalancer struct {
+	lb oxyLoadBalancer
+}
+
+func (h *healthCheckLoadBalancer) RemoveServer(u *url.URL) error {
+	return h.lb.RemoveServer(u)
+}
+
+func (h *healthCheckLoadBalancer) UpsertServer(u *url.URL, weight int) error {
+	return h.lb.UpsertServer(u, roundrobin.Weight(weight))
+}
+
+func (h *healthCheckLoadBalancer) Servers() []*url.URL {
+	return h.lb.Servers()
+}
+
+// ServerWeight returns the weight of a server if the load balancer tracks it, as the round robin does.
+func (h *healthCheckLoadBalancer) ServerWeight(u *url.URL) (int, bool) {
+	if weighted, ok := h.lb.(interface {
+		ServerWeight(u *url.URL) (int, bool)
+	}); ok {
+		return weighted.ServerWeight(u)
+	}
+	return 0, false
+}
+
+// configuredWeight returns the weights the configuration intends for the servers of a backend,
+// so that the health check puts the removed servers back with their current weight.
+func configuredWeight(servers map[string]types.Server) func(*url.URL) (int, bool) {
+	weights := make(map[string]int, len(servers))
+	for _, server := range servers {
+		if u, err := url.Parse(server.URL); err == nil {
+			weights[u.String()] = server.Weight
+		}
+	}
+	return func(u *url.URL) (int, bool) {
+		weight, ok := weights[u.String()]
+		return weight, ok
+	}
+}
+
+// healthCheckPorts returns the ports the health check probes the servers of a backend on, by server URL,
+// for the servers setting one.
+func healthCheckPorts(servers map[string]types.Server) map[string]int {
+	var ports map[string]int
+	for _, server := range servers {
+		if server.HealthCheckPort <= 0 {
+			continue
+		}
+		if u, err := url.Parse(server.URL); err == nil {
+			if ports == nil {
+				ports = make(map[string]int)
+			}
+			ports[u.String()] = server.HealthCheckPort
+		}
+	}
+	return ports
+}
+
+func parseHealthCheckOptions(lb healthcheck.LoadBalancer, hc *types.HealthCheck) (*healthcheck.Options, error) {
+	var err error
+	var interval time.Duration
+	if hc.Interval != "" {
+		interval, err = healthcheck.ParseInterval(hc.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck interval: %v", err)
+		}
+	}
+	var timeout time.Duration
+	if hc.Timeout != "" {
+		timeout, err = time.ParseDuration(hc.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck timeout: %v", err)
+		}
+	}
+	var maxBackoff time.Duration
+	if hc.MaxBackoff != "" {
+		maxBackoff, err = time.ParseDuration(hc.MaxBackoff)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck max backoff: %v", err)
+		}
+	}
+	var circuitCooldown time.Duration
+	if hc.CircuitCooldown != "" {
+		circuitCooldown, err = time.ParseDuration(hc.CircuitCooldown)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck circuit cooldown: %v", err)
+		}
+	}
+	var dnsCacheTTL time.Duration
+	if hc.DNSCacheTTL != "" {
+		dnsCacheTTL, err = time.ParseDuration(hc.DNSCacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck DNS cache TTL: %v", err)
+		}
+	}
+	var minCertValidity time.Duration
+	if hc.MinCertValidity != "" {
+		minCertValidity, err = time.ParseDuration(hc.MinCertValidity)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck min cert validity: %v", err)
+		}
+	}
+	var warmupGrace time.Duration
+	if hc.WarmupGrace != "" {
+		warmupGrace, err = time.ParseDuration(hc.WarmupGrace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck warmup grace: %v", err)
+		}
+	}
+	var deepInterval time.Duration
+	if hc.DeepInterval != "" {
+		deepInterval, err = time.ParseDuration(hc.DeepInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck deep interval: %v", err)
+		}
+	}
+	var maxLatency time.Duration
+	if hc.MaxLatency != "" {
+		maxLatency, err = time.ParseDuration(hc.MaxLatency)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck max latency: %v", err)
+		}
+	}
+	var unhealthyDuration time.Duration
+	if hc.UnhealthyDuration != "" {
+		unhealthyDuration, err = time.ParseDuration(hc.UnhealthyDuration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck unhealthy duration: %v", err)
+		}
+	}
+	var healthyDuration time.Duration
+	if hc.HealthyDuration != "" {
+		healthyDuration, err = time.ParseDuration(hc.HealthyDuration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck healthy duration: %v", err)
+		}
+	}
+	var slowStart time.Duration
+	if hc.SlowStart != "" {
+		slowStart, err = time.ParseDuration(hc.SlowStart)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck slow start: %v", err)
+		}
+	}
+	certificates, rootCAs, err := parseHealthCheckTLS(hc.TLS)
+	if err != nil {
+		return nil, err
+	}
+	var tlsServerName string
+	if hc.TLS != nil {
+		tlsServerName = hc.TLS.ServerName
+	}
+	expectedStatus, err := healthcheck.ParseStatusCodes(hc.ExpectedStatus)
+	if err != nil {
+		return nil, err
+	}
+	expectedStatusClasses, err := healthcheck.ParseStatusClasses(hc.ExpectedStatusClass)
+	if err != nil {
+		return nil, err
+	}
+	expectedStatus = append(expectedStatus, expectedStatusClasses...)
+	drainStatus, err := healthcheck.ParseStatusCodes(hc.DrainStatus)
+	if err != nil {
+		return nil, err
+	}
+	var expectedBodyRegexp *regexp.Regexp
+	if hc.ExpectedBodyRegexp != "" {
+		expectedBodyRegexp, err = regexp.Compile(hc.ExpectedBodyRegexp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck expected body regexp: %v", err)
+		}
+	}
+	mode := strings.ToLower(hc.Mode)
+	if mode == "" {
+		mode = healthcheck.ModeHTTP
+	}
+	var schemeURLs map[string]string
+	for scheme, path := range hc.SchemeURLs {
+		scheme = strings.ToLower(scheme)
+		if scheme != "http" && scheme != "https" {
+			return nil, fmt.Errorf("invalid healthcheck scheme URL for scheme %q", scheme)
+		}
+		if schemeURLs == nil {
+			schemeURLs = make(map[string]string)
+		}
+		schemeURLs[scheme] = path
+	}
+	require := strings.ToLower(hc.Require)
+	scheme := strings.ToLower(hc.Scheme)
+	var resolver *net.Resolver
+	if hc.Resolver != "" {
+		if _, _, err := net.SplitHostPort(hc.Resolver); err != nil {
+			return nil, fmt.Errorf("invalid healthcheck resolver %q: %v", hc.Resolver, err)
+		}
+		resolver = healthcheck.NewResolver(hc.Resolver)
+	}
+	options := &healthcheck.Options{
+		Mode:                mode,
+		URL:                 hc.URL,
+		SchemeURLs:          schemeURLs,
+		URLs:                hc.URLs,
+		Require:             require,
+		Scheme:              scheme,
+		Port:                hc.Port,
+		Socket:              hc.Socket,
+		Hosts:               hc.Hosts,
+		Resolver:            resolver,
+		DNSCacheTTL:         dnsCacheTTL,
+		InsecureSkipVerify:  hc.InsecureSkipVerify,
+		Certificates:        certificates,
+		RootCAs:             rootCAs,
+		TLSServerName:       tlsServerName,
+		MinCertValidity:     minCertValidity,
+		GRPCService:         hc.GRPCService,
+		Payload:             hc.Payload,
+		Command:             hc.Command,
+		Method:              hc.Method,
+		HTTP2:               hc.HTTP2,
+		FollowRedirects:     hc.FollowRedirects,
+		UseProxy:            hc.UseProxy,
+		Body:                hc.Body,
+		ContentType:         hc.ContentType,
+		UserAgent:           hc.UserAgent,
+		Accept:              hc.Accept,
+		Username:            hc.Username,
+		Password:            healthcheck.Secret(hc.Password),
+		Headers:             hc.Headers,
+		Interval:            interval,
+		Retries:             hc.Retries,
+		Timeout:             timeout,
+		ObserveOnly:         hc.ObserveOnly,
+		StartUnhealthy:      hc.StartUnhealthy,
+		SkipInitialCheck:    hc.SkipInitialCheck,
+		FastAdmission:       hc.FastAdmission,
+		FailOpen:            hc.FailOpen,
+		MaxEjectionPercent:  hc.MaxEjectionPercent,
+		MaxConcurrentChecks: hc.MaxConcurrentChecks,
+		MaxBackoff:          maxBackoff,
+		CircuitThreshold:    hc.CircuitThreshold,
+		CircuitCooldown:     circuitCooldown,
+		SlowStart:           slowStart,
+		Jitter:              hc.Jitter,
+		InitialJitter:       hc.InitialJitter,
+		ExpectedStatus:      expectedStatus,
+		DrainStatus:         drainStatus,
+		ExpectedHeaders:     hc.ExpectedHeaders,
+		LoadHeader:          hc.LoadHeader,
+		ExpectedBody:        hc.ExpectedBody,
+		ExpectedBodyRegexp:  expectedBodyRegexp,
+		WarmupGrace:         warmupGrace,
+		DeepURL:             hc.DeepURL,
+		DeepInterval:        deepInterval,
+		MaxLatency:          maxLatency,
+		UnhealthyThreshold:  hc.UnhealthyThreshold,
+		HealthyThreshold:    hc.HealthyThreshold,
+		UnhealthyDuration:   unhealthyDuration,
+		HealthyDuration:     healthyDuration,
+		LB:                  lb,
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// parseHealthCheckTLS loads the client certificate and the CA bundle of the health check probes.
+func parseHealthCheckTLS(config *types.HealthCheckTLS) ([]tls.Certificate, *x509.CertPool, error) {
+	if config == nil {
+		return nil, nil, nil
+	}
+	var certificates []tls.Certificate
+	if config.Cert != "" || config.Key != "" {
+		cert, err := tls.LoadX509KeyPair(config.Cert, config.Key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid healthcheck client certificate: %v", err)
+		}
+		certificates = []tls.Certificate{cert}
+	}
+	var rootCAs *x509.CertPool
+	if config.CA != "" {
+		data, err := ioutil.ReadFile(config.CA)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid healthcheck CA: %v", err)
+		}
+		rootCAs = x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(data) {
+			return nil, nil, errors.New("invalid certificate(s) in " + config.CA)
+		}
+	}
+	return certificates, rootCAs, nil
+}
+
 func (server *Server) wireFrontendBackend(serverRoute *serverRoute, handler http.Handler) {
 	// add prefix
 	if len(serverRoute.addPrefix) > 0 {
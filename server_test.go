@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/containous/flaeg"
+	"github.com/containous/traefik/healthcheck"
+)
+
+func TestNewServerHealthCheckDefaults(t *testing.T) {
+	first := NewServer(GlobalConfiguration{HealthCheck: &HealthCheckConfig{
+		Interval:           flaeg.Duration(10 * time.Second),
+		UnhealthyThreshold: 3,
+	}})
+	second := NewServer(GlobalConfiguration{HealthCheck: &HealthCheckConfig{
+		Interval:         flaeg.Duration(time.Minute),
+		HealthyThreshold: 2,
+	}})
+	if first.HealthCheck() == second.HealthCheck() {
+		t.Fatal("expected each server to own its health check")
+	}
+
+	backend := first.HealthCheck().NewBackendHealthCheck(healthcheck.Options{URL: "/health"})
+	if backend.Interval != 10*time.Second || backend.UnhealthyThreshold != 3 || backend.HealthyThreshold != 1 {
+		t.Errorf("expected the defaults of the first server, got interval %s and thresholds %d/%d", backend.Interval, backend.UnhealthyThreshold, backend.HealthyThreshold)
+	}
+	backend = second.HealthCheck().NewBackendHealthCheck(healthcheck.Options{URL: "/health"})
+	if backend.Interval != time.Minute || backend.UnhealthyThreshold != 1 || backend.HealthyThreshold != 2 {
+		t.Errorf("expected the defaults of the second server, got interval %s and thresholds %d/%d", backend.Interval, backend.UnhealthyThreshold, backend.HealthyThreshold)
+	}
+}
@@ -39,14 +39,81 @@ type CircuitBreaker struct {
 
 // HealthCheck holds HealthCheck configuration
 type HealthCheck struct {
-	URL      string `json:"url,omitempty"`
-	Interval string `json:"interval,omitempty"`
+	Mode                string            `json:"mode,omitempty"`
+	URL                 string            `json:"url,omitempty"`
+	SchemeURLs          map[string]string `json:"schemeURLs,omitempty"`
+	URLs                []string          `json:"urls,omitempty"`
+	Require             string            `json:"require,omitempty"`
+	Scheme              string            `json:"scheme,omitempty"`
+	Port                int               `json:"port,omitempty"`
+	Socket              string            `json:"socket,omitempty"`
+	Hosts               map[string]string `json:"hosts,omitempty"`
+	Resolver            string            `json:"resolver,omitempty"`
+	InsecureSkipVerify  bool              `json:"insecureSkipVerify,omitempty"`
+	TLS                 *HealthCheckTLS   `json:"tls,omitempty"`
+	MinCertValidity     string            `json:"minCertValidity,omitempty"`
+	GRPCService         string            `json:"grpcService,omitempty"`
+	Payload             string            `json:"payload,omitempty"`
+	Command             []string          `json:"command,omitempty"`
+	Method              string            `json:"method,omitempty"`
+	HTTP2               bool              `json:"http2,omitempty"`
+	FollowRedirects     bool              `json:"followRedirects,omitempty"`
+	UseProxy            bool              `json:"useProxy,omitempty"`
+	Body                string            `json:"body,omitempty"`
+	ContentType         string            `json:"contentType,omitempty"`
+	UserAgent           string            `json:"userAgent,omitempty"`
+	Accept              string            `json:"accept,omitempty"`
+	Username            string            `json:"username,omitempty"`
+	Password            string            `json:"password,omitempty"`
+	Headers             map[string]string `json:"headers,omitempty"`
+	Interval            string            `json:"interval,omitempty"`
+	Retries             int               `json:"retries,omitempty"`
+	Timeout             string            `json:"timeout,omitempty"`
+	ObserveOnly         bool              `json:"observeOnly,omitempty"`
+	StartUnhealthy      bool              `json:"startUnhealthy,omitempty"`
+	SkipInitialCheck    bool              `json:"skipInitialCheck,omitempty"`
+	FastAdmission       bool              `json:"fastAdmission,omitempty"`
+	FailOpen            bool              `json:"failOpen,omitempty"`
+	MaxEjectionPercent  int               `json:"maxEjectionPercent,omitempty"`
+	MaxConcurrentChecks int               `json:"maxConcurrentChecks,omitempty"`
+	MaxBackoff          string            `json:"maxBackoff,omitempty"`
+	CircuitThreshold    int               `json:"circuitThreshold,omitempty"`
+	CircuitCooldown     string            `json:"circuitCooldown,omitempty"`
+	DNSCacheTTL         string            `json:"dnsCacheTTL,omitempty"`
+	Jitter              int               `json:"jitter,omitempty"`
+	InitialJitter       bool              `json:"initialJitter,omitempty"`
+	SlowStart           string            `json:"slowStart,omitempty"`
+	ExpectedStatus      string            `json:"expectedStatus,omitempty"`
+	ExpectedStatusClass string            `json:"expectedStatusClass,omitempty"`
+	DrainStatus         string            `json:"drainStatus,omitempty"`
+	ExpectedHeaders     map[string]string `json:"expectedHeaders,omitempty"`
+	LoadHeader          string            `json:"loadHeader,omitempty"`
+	ExpectedBody        string            `json:"expectedBody,omitempty"`
+	ExpectedBodyRegexp  string            `json:"expectedBodyRegexp,omitempty"`
+	WarmupGrace         string            `json:"warmupGrace,omitempty"`
+	DeepURL             string            `json:"deepURL,omitempty"`
+	DeepInterval        string            `json:"deepInterval,omitempty"`
+	MaxLatency          string            `json:"maxLatency,omitempty"`
+	UnhealthyThreshold  int               `json:"unhealthyThreshold,omitempty"`
+	HealthyThreshold    int               `json:"healthyThreshold,omitempty"`
+	UnhealthyDuration   string            `json:"unhealthyDuration,omitempty"`
+	HealthyDuration     string            `json:"healthyDuration,omitempty"`
+}
+
+// HealthCheckTLS holds the client certificate files of the health check probes.
+type HealthCheckTLS struct {
+	CA         string `json:"ca,omitempty"`
+	Cert       string `json:"cert,omitempty"`
+	Key        string `json:"key,omitempty"`
+	ServerName string `json:"serverName,omitempty"`
 }
 
 // Server holds server configuration.
 type Server struct {
 	URL    string `json:"url,omitempty"`
 	Weight int    `json:"weight"`
+	// HealthCheckPort overrides the port the health check of the backend probes the server on, when not zero.
+	HealthCheckPort int `json:"healthCheckPort,omitempty"`
 }
 
 // Route holds route configuration.
@@ -99,6 +166,53 @@ type Configuration struct {
 	Frontends map[string]*Frontend `json:"frontends,omitempty"`
 }
 
+// Redacted replaces the health check passwords of a configuration when it is logged or exposed.
+const Redacted = "<redacted>"
+
+// Redacted returns a copy of the backend without the password of its health check.
+func (b *Backend) Redacted() *Backend {
+	if b == nil || b.HealthCheck == nil || b.HealthCheck.Password == "" {
+		return b
+	}
+	redacted := *b
+	healthCheck := *b.HealthCheck
+	healthCheck.Password = Redacted
+	redacted.HealthCheck = &healthCheck
+	return &redacted
+}
+
+// Redacted returns a copy of the configuration without the passwords of its health checks.
+func (c *Configuration) Redacted() *Configuration {
+	if c == nil || c.Backends == nil {
+		return c
+	}
+	redacted := &Configuration{Backends: make(map[string]*Backend, len(c.Backends)), Frontends: c.Frontends}
+	for backendID, backend := range c.Backends {
+		redacted.Backends[backendID] = backend.Redacted()
+	}
+	return redacted
+}
+
+// RestorePasswords sets back the health check passwords of the backends whose password is Redacted,
+// as read back from the API, to the ones of the same backends in the current configuration.
+func (c *Configuration) RestorePasswords(current *Configuration) {
+	if c == nil {
+		return
+	}
+	for backendID, backend := range c.Backends {
+		if backend == nil || backend.HealthCheck == nil || backend.HealthCheck.Password != Redacted {
+			continue
+		}
+		backend.HealthCheck.Password = ""
+		if current == nil {
+			continue
+		}
+		if previous, ok := current.Backends[backendID]; ok && previous != nil && previous.HealthCheck != nil {
+			backend.HealthCheck.Password = previous.HealthCheck.Password
+		}
+	}
+}
+
 // ConfigMessage hold configuration information exchanged between parts of traefik.
 type ConfigMessage struct {
 	ProviderName  string
@@ -271,6 +385,35 @@ type Prometheus struct {
 	Buckets Buckets `description:"Buckets for latency metrics"`
 }
 
+// Commands holds the paths of the commands the exec health checks are allowed to run.
+type Commands []string
+
+// Set adds the comma-separated paths of str to the commands.
+func (c *Commands) Set(str string) error {
+	for _, command := range strings.Split(str, ",") {
+		if command = strings.TrimSpace(command); command != "" {
+			*c = append(*c, command)
+		}
+	}
+	return nil
+}
+
+// Get []string
+func (c *Commands) Get() interface{} { return Commands(*c) }
+
+// String returns the commands as a comma-separated list.
+func (c *Commands) String() string { return strings.Join(*c, ",") }
+
+// SetValue sets []string into the parser
+func (c *Commands) SetValue(val interface{}) {
+	*c = Commands(val.(Commands))
+}
+
+// Type is type of the struct
+func (c *Commands) Type() string {
+	return "commands"
+}
+
 // Buckets holds Prometheus Buckets
 type Buckets []float64
 
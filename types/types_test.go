@@ -0,0 +1,46 @@
+package types
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestConfigurationRedacted(t *testing.T) {
+	configuration := &Configuration{Backends: map[string]*Backend{
+		"backend1": {HealthCheck: &HealthCheck{URL: "/health", Username: "probe", Password: "s3cret"}},
+		"backend2": {},
+	}}
+	redacted := configuration.Redacted()
+	if password := redacted.Backends["backend1"].HealthCheck.Password; password != Redacted {
+		t.Errorf("expected the password to be redacted, got %q", password)
+	}
+	logged, err := json.Marshal(redacted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(logged), "s3cret") {
+		t.Errorf("expected the password not to be logged, got %s", logged)
+	}
+	if configuration.Backends["backend1"].HealthCheck.Password != "s3cret" {
+		t.Error("expected the configuration itself to keep its password")
+	}
+
+	// the redacted configuration read back from the API keeps the current password
+	var readBack Configuration
+	if err := json.Unmarshal(logged, &readBack); err != nil {
+		t.Fatal(err)
+	}
+	readBack.RestorePasswords(configuration)
+	if password := readBack.Backends["backend1"].HealthCheck.Password; password != "s3cret" {
+		t.Errorf("expected the current password to be restored, got %q", password)
+	}
+
+	readBack = Configuration{Backends: map[string]*Backend{
+		"backend3": {HealthCheck: &HealthCheck{Password: Redacted}},
+	}}
+	readBack.RestorePasswords(configuration)
+	if password := readBack.Backends["backend3"].HealthCheck.Password; password != "" {
+		t.Errorf("expected the placeholder of an unknown backend to be dropped, got %q", password)
+	}
+}
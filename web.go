@@ -7,10 +7,12 @@ import (
 	"io/ioutil"
 	"net/http"
 	"runtime"
+	"time"
 
 	"github.com/codegangsta/negroni"
 	"github.com/containous/mux"
 	"github.com/containous/traefik/autogen"
+	"github.com/containous/traefik/healthcheck"
 	"github.com/containous/traefik/log"
 	"github.com/containous/traefik/middlewares"
 	"github.com/containous/traefik/safe"
@@ -82,6 +84,9 @@ func (provider *WebProvider) Provide(configurationChan chan<- types.ConfigMessag
 	// health route
 	systemRouter.Methods("GET").Path(provider.Path + "health").HandlerFunc(provider.getHealthHandler)
 
+	// health check route
+	systemRouter.Methods("GET").Path(provider.Path + "healthcheck").HandlerFunc(provider.getHealthCheckHandler)
+
 	// ping route
 	systemRouter.Methods("GET").Path(provider.Path + "ping").HandlerFunc(provider.getPingHandler)
 	// API routes
@@ -106,6 +111,8 @@ func (provider *WebProvider) Provide(configurationChan chan<- types.ConfigMessag
 		body, _ := ioutil.ReadAll(request.Body)
 		err := json.Unmarshal(body, configuration)
 		if err == nil {
+			// The passwords read from the API are redacted, keep the ones already set.
+			configuration.RestorePasswords(provider.server.currentConfigurations.Get().(configs)["web"])
 			configurationChan <- types.ConfigMessage{ProviderName: "web", Configuration: configuration}
 			provider.getConfigHandler(response, request)
 		} else {
@@ -173,13 +180,140 @@ func (provider *WebProvider) getHealthHandler(response http.ResponseWriter, requ
 	templatesRenderer.JSON(response, http.StatusOK, health)
 }
 
+// healthCheckRepresentation is the state of the health checks of a backend.
+type healthCheckRepresentation struct {
+	Interval     string                                     `json:"interval"`
+	Timeout      string                                     `json:"timeout"`
+	Paused       bool                                       `json:"paused,omitempty"`
+	DisabledURLs []string                                   `json:"disabledURLs"`
+	Servers      map[string]healthCheckServerRepresentation `json:"servers"`
+}
+
+// healthCheckServerRepresentation is the state of the health checks of a server.
+type healthCheckServerRepresentation struct {
+	Healthy     bool       `json:"healthy"`
+	LastCheck   *time.Time `json:"lastCheck,omitempty"`
+	LastLatency string     `json:"lastLatency,omitempty"`
+	Failures    int        `json:"failures"`
+	Successes   int        `json:"successes"`
+	FailureRate float64    `json:"failureRate"`
+}
+
+func (provider *WebProvider) getHealthCheckHandler(response http.ResponseWriter, request *http.Request) {
+	snapshot := provider.server.HealthCheck().Snapshot()
+	representation := make(map[string]healthCheckRepresentation, len(snapshot))
+	for backendID, backend := range snapshot {
+		servers := make(map[string]healthCheckServerRepresentation, len(backend.Servers))
+		for serverURL, server := range backend.Servers {
+			state := healthCheckServerRepresentation{
+				Healthy:     server.Healthy,
+				Failures:    server.Failures,
+				Successes:   server.Successes,
+				FailureRate: server.FailureRate,
+			}
+			if !server.LastCheck.IsZero() {
+				lastCheck := server.LastCheck
+				state.LastCheck = &lastCheck
+				state.LastLatency = server.LastLatency.String()
+			}
+			servers[serverURL] = state
+		}
+		representation[backendID] = healthCheckRepresentation{
+			Interval:     backend.Interval.String(),
+			Timeout:      backend.Timeout.String(),
+			Paused:       backend.Paused,
+			DisabledURLs: backend.DisabledURLs,
+			Servers:      servers,
+		}
+	}
+	templatesRenderer.JSON(response, http.StatusOK, representation)
+}
+
 func (provider *WebProvider) getPingHandler(response http.ResponseWriter, request *http.Request) {
 	fmt.Fprintf(response, "OK")
 }
 
+// serverRepresentation is a server with the state reported by its health check, if any.
+type serverRepresentation struct {
+	types.Server
+	Health      string     `json:"health,omitempty"`
+	LastCheck   *time.Time `json:"lastCheck,omitempty"`
+	LastLatency string     `json:"lastLatency,omitempty"`
+	FailureRate *float64   `json:"failureRate,omitempty"`
+}
+
+// backendRepresentation is a backend whose servers carry their health.
+type backendRepresentation struct {
+	*types.Backend
+	Servers     map[string]serverRepresentation `json:"servers,omitempty"`
+	HealthRatio *float64                        `json:"healthRatio,omitempty"`
+}
+
+// configurationRepresentation is a provider configuration whose servers carry their health.
+type configurationRepresentation struct {
+	*types.Configuration
+	Backends map[string]backendRepresentation `json:"backends,omitempty"`
+}
+
+func newServerRepresentation(hc *healthcheck.HealthCheck, backendID string, server types.Server) serverRepresentation {
+	representation := serverRepresentation{Server: server}
+	if healthy, checked := hc.ServerHealth(backendID, server.URL); checked {
+		if healthy {
+			representation.Health = "up"
+		} else {
+			representation.Health = "down"
+		}
+	}
+	if checked, latency, ok := hc.LastCheck(backendID, server.URL); ok {
+		representation.LastCheck = &checked
+		representation.LastLatency = latency.String()
+	}
+	if rate, ok := hc.FailureRate(backendID, server.URL); ok {
+		representation.FailureRate = &rate
+	}
+	return representation
+}
+
+func newBackendRepresentation(hc *healthcheck.HealthCheck, backendID string, backend *types.Backend) backendRepresentation {
+	representation := backendRepresentation{Backend: backend.Redacted()}
+	if backend.Servers != nil {
+		representation.Servers = make(map[string]serverRepresentation, len(backend.Servers))
+		for serverID, server := range backend.Servers {
+			representation.Servers[serverID] = newServerRepresentation(hc, backendID, server)
+		}
+	}
+	if ratio, checked := hc.HealthRatio(backendID); checked {
+		representation.HealthRatio = &ratio
+	}
+	return representation
+}
+
+func newBackendsRepresentation(hc *healthcheck.HealthCheck, backends map[string]*types.Backend) map[string]backendRepresentation {
+	if backends == nil {
+		return nil
+	}
+	representation := make(map[string]backendRepresentation, len(backends))
+	for backendID, backend := range backends {
+		representation[backendID] = newBackendRepresentation(hc, backendID, backend)
+	}
+	return representation
+}
+
+func newConfigurationRepresentation(hc *healthcheck.HealthCheck, configuration *types.Configuration) configurationRepresentation {
+	return configurationRepresentation{
+		Configuration: configuration,
+		Backends:      newBackendsRepresentation(hc, configuration.Backends),
+	}
+}
+
 func (provider *WebProvider) getConfigHandler(response http.ResponseWriter, request *http.Request) {
 	currentConfigurations := provider.server.currentConfigurations.Get().(configs)
-	templatesRenderer.JSON(response, http.StatusOK, currentConfigurations)
+	hc := provider.server.HealthCheck()
+	representation := make(map[string]configurationRepresentation, len(currentConfigurations))
+	for providerID, configuration := range currentConfigurations {
+		representation[providerID] = newConfigurationRepresentation(hc, configuration)
+	}
+	templatesRenderer.JSON(response, http.StatusOK, representation)
 }
 
 func (provider *WebProvider) getVersionHandler(response http.ResponseWriter, request *http.Request) {
@@ -197,8 +331,9 @@ func (provider *WebProvider) getProviderHandler(response http.ResponseWriter, re
 	vars := mux.Vars(request)
 	providerID := vars["provider"]
 	currentConfigurations := provider.server.currentConfigurations.Get().(configs)
+	hc := provider.server.HealthCheck()
 	if provider, ok := currentConfigurations[providerID]; ok {
-		templatesRenderer.JSON(response, http.StatusOK, provider)
+		templatesRenderer.JSON(response, http.StatusOK, newConfigurationRepresentation(hc, provider))
 	} else {
 		http.NotFound(response, request)
 	}
@@ -208,8 +343,9 @@ func (provider *WebProvider) getBackendsHandler(response http.ResponseWriter, re
 	vars := mux.Vars(request)
 	providerID := vars["provider"]
 	currentConfigurations := provider.server.currentConfigurations.Get().(configs)
+	hc := provider.server.HealthCheck()
 	if provider, ok := currentConfigurations[providerID]; ok {
-		templatesRenderer.JSON(response, http.StatusOK, provider.Backends)
+		templatesRenderer.JSON(response, http.StatusOK, newBackendsRepresentation(hc, provider.Backends))
 	} else {
 		http.NotFound(response, request)
 	}
@@ -220,9 +356,10 @@ func (provider *WebProvider) getBackendHandler(response http.ResponseWriter, req
 	providerID := vars["provider"]
 	backendID := vars["backend"]
 	currentConfigurations := provider.server.currentConfigurations.Get().(configs)
+	hc := provider.server.HealthCheck()
 	if provider, ok := currentConfigurations[providerID]; ok {
 		if backend, ok := provider.Backends[backendID]; ok {
-			templatesRenderer.JSON(response, http.StatusOK, backend)
+			templatesRenderer.JSON(response, http.StatusOK, newBackendRepresentation(hc, backendID, backend))
 			return
 		}
 	}
@@ -234,9 +371,10 @@ func (provider *WebProvider) getServersHandler(response http.ResponseWriter, req
 	providerID := vars["provider"]
 	backendID := vars["backend"]
 	currentConfigurations := provider.server.currentConfigurations.Get().(configs)
+	hc := provider.server.HealthCheck()
 	if provider, ok := currentConfigurations[providerID]; ok {
 		if backend, ok := provider.Backends[backendID]; ok {
-			templatesRenderer.JSON(response, http.StatusOK, backend.Servers)
+			templatesRenderer.JSON(response, http.StatusOK, newBackendRepresentation(hc, backendID, backend).Servers)
 			return
 		}
 	}
@@ -249,10 +387,11 @@ func (provider *WebProvider) getServerHandler(response http.ResponseWriter, requ
 	backendID := vars["backend"]
 	serverID := vars["server"]
 	currentConfigurations := provider.server.currentConfigurations.Get().(configs)
+	hc := provider.server.HealthCheck()
 	if provider, ok := currentConfigurations[providerID]; ok {
 		if backend, ok := provider.Backends[backendID]; ok {
 			if server, ok := backend.Servers[serverID]; ok {
-				templatesRenderer.JSON(response, http.StatusOK, server)
+				templatesRenderer.JSON(response, http.StatusOK, newServerRepresentation(hc, backendID, server))
 				return
 			}
 		}